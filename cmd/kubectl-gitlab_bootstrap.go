@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/spf13/pflag"
 
 	"gitlab.com/eddiezane/kubectl-gitlab_bootstrap/pkg/cmd"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	// Register the auth provider plugins (oidc, gcp, azure, openstack) used by kubeconfigs
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
 func main() {
@@ -15,6 +18,10 @@ func main() {
 
 	root := cmd.NewCmdGitLabBootstrap(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr})
 	if err := root.Execute(); err != nil {
+		var cmdErr *cmd.Error
+		if errors.As(err, &cmdErr) {
+			os.Exit(cmdErr.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
@@ -1,14 +1,17 @@
 module gitlab.com/eddiezane/kubectl-gitlab_bootstrap
 
-go 1.12
+go 1.13
 
 require (
-	github.com/pkg/errors v0.8.0
-	github.com/spf13/cobra v0.0.5
+	github.com/hashicorp/go-retryablehttp v0.6.4
+	github.com/pkg/errors v0.9.1
+	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.3
-	github.com/xanzy/go-gitlab v0.20.1
-	k8s.io/api v0.0.0-20190831074750-7364b6bdad65
-	k8s.io/apimachinery v0.0.0-20190831074630-461753078381
+	github.com/xanzy/go-gitlab v0.38.1
+	k8s.io/api v0.0.0-20190918155943-95b840bb6a1f
+	k8s.io/apimachinery v0.0.0-20190913080033-27d36303b655
 	k8s.io/cli-runtime v0.0.0-20190831080432-9d670f2021f4
-	k8s.io/client-go v0.0.0-20190831074946-3fe2abece89e
+	k8s.io/client-go v0.0.0-20190918160344-1fbdaa4c8d90
+	sigs.k8s.io/controller-runtime v0.4.0
+	sigs.k8s.io/yaml v1.1.0
 )
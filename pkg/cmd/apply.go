@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+)
+
+// fieldManager returns the server-side apply field manager, defaulting to the plugin name
+func (o *GitLabBootstrapOptions) fieldManager() string {
+	if o.FieldManager == "" {
+		return ManagedByValue
+	}
+	return o.FieldManager
+}
+
+// apply server-side applies obj, which must have its TypeMeta set, and decodes the result into into.
+// An empty namespace applies a cluster scoped object. API servers before Kubernetes 1.16 reject
+// apply patches as an unsupported media type, obj is created or merge patched on those instead.
+func (o *GitLabBootstrapOptions) apply(client restclient.Interface, namespace, resource, name string, obj, into runtime.Object) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	patchOptions := &metav1.PatchOptions{FieldManager: o.fieldManager()}
+	if o.Force {
+		patchOptions.Force = &o.Force
+	}
+	err = client.Patch(types.ApplyPatchType).
+		NamespaceIfScoped(namespace, namespace != "").
+		Resource(resource).
+		Name(name).
+		VersionedParams(patchOptions, scheme.ParameterCodec).
+		Body(data).
+		Do().
+		Into(into)
+	if !apierrors.IsUnsupportedMediaType(err) {
+		return err
+	}
+	return createOrMergePatch(client, namespace, resource, name, data, into)
+}
+
+// create creates obj with the field manager, for objects that can't be applied the first time.
+// Kubernetes 1.16 hands the fields of the empty object an apply starts from to before-first-apply,
+// so applying a ClusterRoleBinding's roleRef over them conflicts.
+func (o *GitLabBootstrapOptions) create(client restclient.Interface, namespace, resource string, obj, into runtime.Object) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return client.Post().
+		NamespaceIfScoped(namespace, namespace != "").
+		Resource(resource).
+		VersionedParams(&metav1.CreateOptions{FieldManager: o.fieldManager()}, scheme.ParameterCodec).
+		Body(data).
+		Do().
+		Into(into)
+}
+
+// createOrMergePatch creates the object encoded in data, or merge patches the existing one so the
+// fields set by the API server, like the token secrets of a ServiceAccount, are kept
+func createOrMergePatch(client restclient.Interface, namespace, resource, name string, data []byte, into runtime.Object) error {
+	err := client.Post().
+		NamespaceIfScoped(namespace, namespace != "").
+		Resource(resource).
+		Body(data).
+		Do().
+		Into(into)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return client.Patch(types.MergePatchType).
+		NamespaceIfScoped(namespace, namespace != "").
+		Resource(resource).
+		Name(name).
+		Body(data).
+		Do().
+		Into(into)
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestApplyWithoutServerSideApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		exists    bool
+		wantCalls []string
+	}{
+		{name: "missing", wantCalls: []string{"PATCH " + string(types.ApplyPatchType), "POST"}},
+		{name: "existing", exists: true, wantCalls: []string{"PATCH " + string(types.ApplyPatchType), "POST", "PATCH " + string(types.MergePatchType)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			// Answers like an API server before Kubernetes 1.16, which doesn't know apply patches
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := r.Method
+				if r.Method == http.MethodPatch {
+					call += " " + r.Header.Get("Content-Type")
+				}
+				calls = append(calls, call)
+				w.Header().Set("Content-Type", "application/json")
+				status := &metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusFailure}
+				switch {
+				case call == "PATCH "+string(types.ApplyPatchType):
+					status.Reason, status.Code = metav1.StatusReasonUnsupportedMediaType, http.StatusUnsupportedMediaType
+				case r.Method == http.MethodPost && tt.exists:
+					status.Reason, status.Code = metav1.StatusReasonAlreadyExists, http.StatusConflict
+				default:
+					body, _ := ioutil.ReadAll(r.Body)
+					w.Write(body)
+					return
+				}
+				w.WriteHeader(int(status.Code))
+				json.NewEncoder(w).Encode(status)
+			}))
+			defer server.Close()
+
+			clientset, err := kubernetes.NewForConfig(&restclient.Config{Host: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			o := newTestOptions()
+			sa := &v1.ServiceAccount{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+				ObjectMeta: o.objectMeta("gitlab-admin"),
+			}
+			into := &v1.ServiceAccount{}
+			if err := o.apply(clientset.CoreV1().RESTClient(), "kube-system", "serviceaccounts", sa.Name, sa, into); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls are %q, want %q", calls, tt.wantCalls)
+			}
+			if into.Name != "gitlab-admin" {
+				t.Errorf("decoded ServiceAccount %q, want gitlab-admin", into.Name)
+			}
+		})
+	}
+}
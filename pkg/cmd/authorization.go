@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Authorization types GitLab accepts for a cluster
+const (
+	AuthorizationRBAC    = "rbac"
+	AuthorizationABAC    = "abac"
+	AuthorizationUnknown = "unknown_authorization"
+)
+
+// validateAuthorization checks the authorization type and project namespace against what GitLab
+// accepts for the cluster type
+func (o *GitLabBootstrapOptions) validateAuthorization() error {
+	switch o.AuthorizationType {
+	case "", AuthorizationRBAC, AuthorizationABAC, AuthorizationUnknown:
+	default:
+		return fmt.Errorf("unsupported authorization type %q, must be one of %s, %s or %s", o.AuthorizationType, AuthorizationRBAC, AuthorizationABAC, AuthorizationUnknown)
+	}
+
+	if o.ProjectNamespace == "" {
+		return nil
+	}
+	if o.gitlabTargetKind() != TargetProject {
+		return fmt.Errorf("--project-namespace only works for project clusters, group and instance clusters get a namespace per project")
+	}
+	if errs := validation.IsDNS1123Label(o.ProjectNamespace); len(errs) > 0 {
+		return fmt.Errorf("invalid project namespace %q: %s", o.ProjectNamespace, strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	// bindingPollInterval is how often the ServiceAccount's permissions are checked
+	bindingPollInterval = time.Second
+	// bindingTimeout bounds how long to wait for the ClusterRoleBinding to become effective
+	bindingTimeout = 30 * time.Second
+)
+
+// parseSubject parses a kind=...,name=...,namespace=... subject for the ClusterRoleBinding
+func parseSubject(arg string) (rbacv1.Subject, error) {
+	var subject rbacv1.Subject
+	for _, field := range strings.Split(arg, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return subject, fmt.Errorf("invalid subject %q, expected kind=...,name=...,namespace=...", arg)
+		}
+		switch parts[0] {
+		case "kind":
+			subject.Kind = parts[1]
+		case "name":
+			subject.Name = parts[1]
+		case "namespace":
+			subject.Namespace = parts[1]
+		default:
+			return subject, fmt.Errorf("invalid subject %q, unknown field %q", arg, parts[0])
+		}
+	}
+
+	switch subject.Kind {
+	case rbacv1.ServiceAccountKind:
+		if subject.Namespace == "" {
+			return subject, fmt.Errorf("invalid subject %q, a ServiceAccount requires a namespace", arg)
+		}
+	case rbacv1.UserKind, rbacv1.GroupKind:
+		if subject.Namespace != "" {
+			return subject, fmt.Errorf("invalid subject %q, a %s is not namespaced", arg, subject.Kind)
+		}
+		subject.APIGroup = rbacv1.GroupName
+	default:
+		return subject, fmt.Errorf("invalid subject %q, kind must be one of %s, %s or %s", arg, rbacv1.ServiceAccountKind, rbacv1.UserKind, rbacv1.GroupKind)
+	}
+	if subject.Name == "" {
+		return subject, fmt.Errorf("invalid subject %q, name is required", arg)
+	}
+	return subject, nil
+}
+
+// WaitForClusterAdmin waits until the ServiceAccount token is authorized to do everything in the
+// cluster, so GitLab doesn't probe the cluster before the ClusterRoleBinding is effective
+func (o *GitLabBootstrapOptions) WaitForClusterAdmin() error {
+	config := restclient.AnonymousClientConfig(o.RestConfig)
+	config.BearerToken = o.ServiceAccountToken
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return wrapKubeError(err, "unable to create Kubernetes client for the service account")
+	}
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:     "*",
+				Group:    "*",
+				Resource: "*",
+			},
+		},
+	}
+	var lastErr error
+	err = wait.PollImmediate(bindingPollInterval, bindingTimeout, func() (bool, error) {
+		result, err := clientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(review)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		return result.Status.Allowed, nil
+	})
+	if err != nil {
+		if lastErr == nil {
+			lastErr = errors.Errorf("access not granted after %s", bindingTimeout)
+		}
+		return wrapKubeError(lastErr, fmt.Sprintf("ClusterRoleBinding %s is not effective", o.clusterRoleBindingName()))
+	}
+	if o.Verbose {
+		fmt.Fprintf(o.ErrOut, "ClusterRoleBinding %s is effective\n", o.clusterRoleBindingName())
+	}
+	return nil
+}
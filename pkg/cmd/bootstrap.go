@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	restclient "k8s.io/client-go/rest"
+)
+
+// Config holds everything needed to bootstrap a Kubernetes cluster into GitLab
+type Config struct {
+	// GitLabURL points at a self-managed GitLab instance. Defaults to https://gitlab.com
+	GitLabURL       string
+	GitLabAPIToken  string
+	GitLabProjectID string
+	// Target is the kind of GitLab cluster to add, one of the Target constants. Defaults to
+	// TargetProject, when GitLabProjectID is a project id or path
+	Target string
+	// Deprecated: GitLabUseGroup and GitLabInstance are folded into Target, set that instead
+	GitLabUseGroup bool
+	GitLabInstance bool
+
+	RestConfig *restclient.Config
+	// Platform of the cluster in GitLab. Only PlatformKubernetes, the default, is supported
+	Platform string
+
+	ClusterName string
+	// ClusterHost and ClusterCA are registered in GitLab. Bootstrap defaults them to the host and
+	// CA of RestConfig
+	ClusterHost string
+	ClusterCA   string
+	// NoPreflight skips the GitLab version and admin probes. SkipTargetCheck also skips checking the
+	// project or group exists, so a wrong id only fails after the Kubernetes objects were created
+	NoPreflight     bool
+	SkipTargetCheck bool
+	// StrictTLS fails, instead of warning, when the API server certificate doesn't validate for
+	// ClusterHost with ClusterCA
+	StrictTLS bool
+	// AllowInsecureClusterURL lets an http ClusterHost through for local testing. GitLab
+	// requires https otherwise
+	AllowInsecureClusterURL bool
+	// AllowPrivateClusterURL lets a loopback or private network ClusterHost be registered on
+	// gitlab.com, which can't reach one
+	AllowPrivateClusterURL bool
+
+	// ExpectClusterName aborts before anything is changed unless ClusterName matches
+	ExpectClusterName string
+	// ClusterDomain is the base domain GitLab uses for Auto DevOps. Left unset when empty
+	ClusterDomain string
+
+	// ServiceAccountNamespace holds the gitlab-admin ServiceAccount and its token. Defaults to kube-system
+	ServiceAccountNamespace string
+	// CreateNamespaceIfMissing creates ServiceAccountNamespace before the ServiceAccount
+	CreateNamespaceIfMissing bool
+
+	// Labels are added to the created objects alongside the managed-by label
+	Labels map[string]string
+	// Annotations are added to the created objects
+	Annotations map[string]string
+	// ClusterRoleBindingName names the cluster-admin binding. Defaults to gitlab-admin
+	ClusterRoleBindingName string
+	// ExtraSubjects are bound to cluster-admin alongside the gitlab-admin ServiceAccount
+	ExtraSubjects []rbacv1.Subject
+	// EnvironmentScope of the cluster in GitLab. Defaults to all environments
+	EnvironmentScope string
+	// Environment scopes the cluster to a single environment of the GitLab project. It must
+	// already exist unless CreateEnvironment is set
+	Environment       string
+	CreateEnvironment bool
+	// Unmanaged registers the cluster as not GitLab-managed. Clusters are GitLab-managed by
+	// default, as with the CLI's --managed
+	Unmanaged bool
+	// AuthorizationType tells GitLab how the cluster authorizes the objects it creates for a
+	// GitLab-managed cluster, one of the AuthorizationType constants. GitLab defaults to rbac
+	AuthorizationType string
+	// ProjectNamespace is the namespace GitLab deploys a project cluster's project to. GitLab
+	// names one per environment when empty
+	ProjectNamespace string
+
+	// TokenMode is one of TokenModeAuto, TokenModeSecret or TokenModeRequest. Defaults to auto
+	TokenMode string
+	// TokenSecret names the ServiceAccount token secret to read. Defaults to the newest one
+	TokenSecret string
+	// TokenAudience requests a bound token through the TokenRequest API instead of reading a secret
+	TokenAudience string
+	TokenDuration time.Duration
+	// TokenWaitTimeout and TokenPollInterval bound the wait for the token controller to populate
+	// the token secret. Default to 30s and 1s
+	TokenWaitTimeout  time.Duration
+	TokenPollInterval time.Duration
+
+	// Force recreates a ClusterRoleBinding whose roleRef or subjects drifted and forces
+	// server-side apply conflicts with other field managers
+	Force bool
+	// FieldManager server-side applies the created objects. Defaults to the plugin name
+	FieldManager string
+	// SkipServiceAccount, SkipClusterRoleBinding and SkipRegister skip a step for objects or
+	// registrations managed elsewhere
+	SkipServiceAccount     bool
+	SkipClusterRoleBinding bool
+	SkipRegister           bool
+	// Record records a GitLabBootstrapped Event on the ServiceAccount after registering the cluster
+	Record bool
+	// Replace deletes a GitLab cluster with the same name before adding it. Requires Yes as
+	// Bootstrap can't ask for confirmation
+	Replace bool
+	// WaitForBinding waits for the ServiceAccount to be cluster-admin before registering the cluster
+	WaitForBinding bool
+
+	WriteKubeConfig string
+	PrintToken      bool
+	// Yes skips confirmations. Bootstrap can't ask for them so registering a cluster on
+	// gitlab.com, where GitLabURL is empty, requires it
+	Yes bool
+}
+
+// ResultAPIVersion versions the JSON form of Result printed by -o json. Fields may be added
+// freely, removing, renaming or changing the meaning of one needs a new version.
+const ResultAPIVersion = "gitlab-bootstrap/v1"
+
+// Result describes the cluster registered in GitLab
+type Result struct {
+	// APIVersion is always ResultAPIVersion
+	APIVersion  string `json:"api_version"`
+	ClusterID   int    `json:"cluster_id"`
+	ClusterURL  string `json:"cluster_url"`
+	ClusterName string `json:"cluster_name"`
+	// ServiceAccount and Namespace identify the ServiceAccount whose token GitLab uses
+	ServiceAccount string `json:"service_account"`
+	Namespace      string `json:"namespace"`
+}
+
+// Bootstrap creates the gitlab-admin ServiceAccount and ClusterRoleBinding in the cluster
+// described by cfg and registers the cluster in GitLab. Informational output is discarded.
+func Bootstrap(ctx context.Context, cfg Config) (Result, error) {
+	if cfg.RestConfig == nil {
+		return Result{}, &Error{Stage: StageValidate, Err: fmt.Errorf("RestConfig is required")}
+	}
+	o := NewGitLabBootstrapOptions(genericclioptions.IOStreams{In: &bytes.Buffer{}, Out: ioutil.Discard, ErrOut: ioutil.Discard})
+	o.Config = cfg
+	o.NoHints = true
+	if err := o.completeFromRestConfig(); err != nil {
+		return Result{}, classifyError(err, StageValidate)
+	}
+	if err := o.completeKubeClientSet(); err != nil {
+		return Result{}, classifyError(err, StageValidate)
+	}
+	return o.bootstrap(ctx)
+}
+
+// completeFromRestConfig defaults ClusterHost and ClusterCA to those of RestConfig, the way the
+// CLI takes them from the kubeconfig, and normalizes ClusterCA to PEM
+func (o *GitLabBootstrapOptions) completeFromRestConfig() error {
+	if o.ClusterHost == "" {
+		o.ClusterHost = o.RestConfig.Host
+	}
+	if o.ClusterCA == "" {
+		ca, err := restConfigCA(o.RestConfig)
+		if err != nil {
+			return err
+		}
+		o.ClusterCA = ca
+	}
+	ca, err := normalizeCA(o.ClusterCA)
+	if err != nil {
+		return err
+	}
+	o.ClusterCA = ca
+	return nil
+}
+
+// bootstrap validates the options and runs every bootstrap step
+func (o *GitLabBootstrapOptions) bootstrap(ctx context.Context) (Result, error) {
+	o.ctx = ctx
+	if err := o.CheckClusterReachable(); err != nil {
+		return Result{}, err
+	}
+	if err := o.Validate(); err != nil {
+		return Result{}, classifyError(err, StageValidate)
+	}
+	if err := o.Run(); err != nil {
+		return Result{}, o.explainRevokedToken(err)
+	}
+	return o.Result, nil
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// resultGolden is the JSON form of testResult for each ResultAPIVersion. Fields may be added to
+// Result freely, removing or renaming one fails the test until ResultAPIVersion is bumped and a
+// golden entry is added for the new version.
+var resultGolden = map[string]string{
+	"gitlab-bootstrap/v1": `{
+		"api_version": "gitlab-bootstrap/v1",
+		"cluster_id": 42,
+		"cluster_url": "https://gitlab.example.com/group/project/clusters/42",
+		"cluster_name": "prod",
+		"service_account": "gitlab-admin",
+		"namespace": "kube-system"
+	}`,
+}
+
+var testResult = Result{
+	APIVersion:     ResultAPIVersion,
+	ClusterID:      42,
+	ClusterURL:     "https://gitlab.example.com/group/project/clusters/42",
+	ClusterName:    "prod",
+	ServiceAccount: "gitlab-admin",
+	Namespace:      "kube-system",
+}
+
+func TestResultJSONContract(t *testing.T) {
+	golden, ok := resultGolden[ResultAPIVersion]
+	if !ok {
+		t.Fatalf("no golden JSON for ResultAPIVersion %s, add one to resultGolden", ResultAPIVersion)
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal([]byte(golden), &want); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(testResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	for field, value := range want {
+		gotValue, ok := got[field]
+		if !ok {
+			t.Errorf("field %q of %s is missing, removing or renaming a field needs a new ResultAPIVersion", field, ResultAPIVersion)
+			continue
+		}
+		if !reflect.DeepEqual(gotValue, value) {
+			t.Errorf("field %q of %s is %v, want %v", field, ResultAPIVersion, gotValue, value)
+		}
+	}
+}
+
+func TestCompleteFromRestConfig(t *testing.T) {
+	ca := selfSignedCertPEM(t)
+	caFile, cleanup := writeTempFile(t, ca)
+	defer cleanup()
+	otherCA := selfSignedCertPEM(t)
+
+	tests := []struct {
+		name       string
+		restConfig *restclient.Config
+		host       string
+		ca         string
+		wantHost   string
+		wantCA     string
+		wantErr    bool
+	}{
+		{
+			name:       "CA data",
+			restConfig: &restclient.Config{Host: "https://k8s.example.com:6443", TLSClientConfig: restclient.TLSClientConfig{CAData: []byte(ca)}},
+			wantHost:   "https://k8s.example.com:6443",
+			wantCA:     ca,
+		},
+		{
+			name:       "CA file",
+			restConfig: &restclient.Config{Host: "https://k8s.example.com:6443", TLSClientConfig: restclient.TLSClientConfig{CAFile: caFile}},
+			wantHost:   "https://k8s.example.com:6443",
+			wantCA:     ca,
+		},
+		{
+			name:       "explicit host and base64 CA",
+			restConfig: &restclient.Config{Host: "https://10.0.0.1:6443", TLSClientConfig: restclient.TLSClientConfig{CAData: []byte(ca)}},
+			host:       "https://k8s.example.com",
+			ca:         base64.StdEncoding.EncodeToString([]byte(otherCA)),
+			wantHost:   "https://k8s.example.com",
+			wantCA:     otherCA,
+		},
+		{
+			name:       "invalid CA",
+			restConfig: &restclient.Config{Host: "https://k8s.example.com:6443", TLSClientConfig: restclient.TLSClientConfig{CAData: []byte("not a certificate")}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			o.RestConfig = tt.restConfig
+			o.ClusterHost = tt.host
+			o.ClusterCA = tt.ca
+
+			err := o.completeFromRestConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.ClusterHost != tt.wantHost {
+				t.Errorf("ClusterHost is %q, want %q", o.ClusterHost, tt.wantHost)
+			}
+			if o.ClusterCA != tt.wantCA {
+				t.Errorf("ClusterCA is %q, want %q", o.ClusterCA, tt.wantCA)
+			}
+		})
+	}
+}
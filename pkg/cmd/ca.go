@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// normalizeCA returns ca as PEM, decoding it first if it is base64 encoded PEM
+func normalizeCA(ca string) (string, error) {
+	if ca == "" {
+		return "", nil
+	}
+	if block, _ := pem.Decode([]byte(ca)); block == nil {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ca))
+		if err != nil {
+			return "", fmt.Errorf("cluster CA is neither PEM nor base64 encoded PEM")
+		}
+		if block, _ := pem.Decode(decoded); block == nil {
+			return "", fmt.Errorf("cluster CA is neither PEM nor base64 encoded PEM")
+		}
+		ca = string(decoded)
+	}
+	if err := validateCABundle(ca); err != nil {
+		return "", err
+	}
+	return ca, nil
+}
+
+// validateCABundle ensures every block of a possibly concatenated PEM bundle parses and that
+// it holds at least one certificate. Errors point at the byte offset of the bad block.
+func validateCABundle(bundle string) error {
+	data := []byte(bundle)
+	rest := data
+	certificates := 0
+	for {
+		// pem.Decode silently skips anything before a block, so check each one starts right away
+		rest = bytes.TrimLeftFunc(rest, unicode.IsSpace)
+		if len(rest) == 0 {
+			break
+		}
+		offset := len(data) - len(rest)
+		if !bytes.HasPrefix(rest, []byte("-----BEGIN ")) {
+			return fmt.Errorf("cluster CA has data that isn't a PEM block at byte %d", offset)
+		}
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return fmt.Errorf("cluster CA has a malformed PEM block at byte %d", offset)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return errors.Wrapf(err, "cluster CA has an invalid certificate at byte %d", offset)
+		}
+		certificates++
+	}
+	if certificates == 0 {
+		return fmt.Errorf("cluster CA has no CERTIFICATE block")
+	}
+	return nil
+}
+
+// mergeCA appends the PEM blocks of ca missing from bundle, so both the old and the new CA are
+// trusted during a CA rotation
+func mergeCA(bundle, ca string) (string, error) {
+	seen := map[string]bool{}
+	var merged []byte
+	for _, data := range []string{bundle, ca} {
+		rest := []byte(data)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			encoded := pem.EncodeToMemory(block)
+			if seen[string(encoded)] {
+				continue
+			}
+			seen[string(encoded)] = true
+			merged = append(merged, encoded...)
+		}
+		if len(bytes.TrimSpace(rest)) > 0 {
+			return "", fmt.Errorf("CA bundle has trailing data that isn't PEM")
+		}
+	}
+	if err := validateCABundle(string(merged)); err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+// clusterCAFromConfigMap reads the cluster CA the API server publishes in the kube-root-ca.crt
+// ConfigMap of the ServiceAccount namespace, on Kubernetes 1.20 and newer. It returns an empty CA
+// if there is none. The extension-apiserver-authentication ConfigMap isn't a fallback, its
+// client-ca-file signs client certificates rather than the serving certificate.
+func (o *GitLabBootstrapOptions) clusterCAFromConfigMap() (string, error) {
+	namespace := o.serviceAccountNamespace()
+	cm, err := o.KubeClientSet.CoreV1().ConfigMaps(namespace).Get("kube-root-ca.crt", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", wrapKubeError(err, fmt.Sprintf("unable to get configmap %s/kube-root-ca.crt", namespace))
+	}
+	return cm.Data["ca.crt"], nil
+}
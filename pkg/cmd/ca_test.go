@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"strconv"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNormalizeCA(t *testing.T) {
+	cert := selfSignedCertPEM(t)
+	otherCert := selfSignedCertPEM(t)
+	bundle := cert + otherCert
+	notACert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("garbage")}))
+
+	tests := []struct {
+		name    string
+		ca      string
+		want    string
+		wantErr string
+	}{
+		{name: "empty", ca: "", want: ""},
+		{name: "PEM", ca: cert, want: cert},
+		{name: "base64 PEM", ca: base64.StdEncoding.EncodeToString([]byte(cert)), want: cert},
+		{name: "base64 PEM with trailing newline", ca: base64.StdEncoding.EncodeToString([]byte(cert)) + "\n", want: cert},
+		{name: "bundle", ca: bundle, want: bundle},
+		{name: "base64 bundle", ca: base64.StdEncoding.EncodeToString([]byte(bundle)), want: bundle},
+		{name: "garbage", ca: "not a certificate", wantErr: "neither PEM nor base64 encoded PEM"},
+		{name: "base64 garbage", ca: base64.StdEncoding.EncodeToString([]byte("not a certificate")), wantErr: "neither PEM nor base64 encoded PEM"},
+		{name: "garbage between blocks", ca: cert + "junk\n" + otherCert, wantErr: "isn't a PEM block at byte " + strconv.Itoa(len(cert))},
+		{name: "invalid certificate in bundle", ca: cert + notACert, wantErr: "invalid certificate at byte " + strconv.Itoa(len(cert))},
+		{name: "no certificate", ca: key, wantErr: "no CERTIFICATE block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeCA(tt.ca)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterCAFromConfigMap(t *testing.T) {
+	cert := selfSignedCertPEM(t)
+	clientCA := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "extension-apiserver-authentication", Namespace: "kube-system"},
+		Data:       map[string]string{"client-ca-file": cert},
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    string
+	}{
+		{name: "kube-root-ca.crt", objects: []runtime.Object{clientCA, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt", Namespace: "kube-system"},
+			Data:       map[string]string{"ca.crt": cert},
+		}}, want: cert},
+		// The client CA doesn't sign the serving certificate, so it's no fallback
+		{name: "only the client CA", objects: []runtime.Object{clientCA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			o.KubeClientSet = fake.NewSimpleClientset(tt.objects...)
+			ca, err := o.clusterCAFromConfigMap()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ca != tt.want {
+				t.Errorf("got CA %q, want %q", ca, tt.want)
+			}
+		})
+	}
+}
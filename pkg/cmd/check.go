@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	gitlab "github.com/xanzy/go-gitlab"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewCmdCheck creates and returns the check subcommand
+func NewCmdCheck(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check [project id]",
+		Short: "Runs the preflight checks of a bootstrap without changing the cluster or GitLab",
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			return o.RunChecks(c, args)
+		}),
+	}
+
+	o.addErrorOutputFlag(cmd)
+
+	return cmd
+}
+
+// RunChecks runs every preflight check using only read calls, printing a pass/fail checklist.
+// Checks after a failed one that they depend on are not run.
+func (o *GitLabBootstrapOptions) RunChecks(cmd *cobra.Command, args []string) error {
+	checks := []runStep{
+		{"Kubeconfig loads", func() error {
+			if err := o.Complete(cmd, args); err != nil {
+				return err
+			}
+			return o.requireSingleTarget()
+		}},
+		{"Kubernetes cluster is reachable", o.CheckClusterReachable},
+		{"ServiceAccount namespace exists", o.checkNamespace},
+		{"ClusterRole cluster-admin exists", func() error {
+			_, err := o.KubeClientSet.RbacV1().ClusterRoles().Get("cluster-admin", metav1.GetOptions{})
+			return err
+		}},
+		{"GitLab token is valid and the target exists", o.Validate},
+		{"GitLab token has the api scope", o.checkTokenScope},
+	}
+
+	for i, check := range checks {
+		if err := check.run(); err != nil {
+			fmt.Fprintf(o.Out, "FAIL  %s: %v\n", check.title, err)
+			for _, skipped := range checks[i+1:] {
+				fmt.Fprintf(o.Out, "SKIP  %s\n", skipped.title)
+			}
+			return &Error{Stage: StageValidate, Err: fmt.Errorf("check %q failed", check.title)}
+		}
+		fmt.Fprintf(o.Out, "PASS  %s\n", check.title)
+	}
+	return nil
+}
+
+// checkNamespace ensures the ServiceAccount namespace exists
+func (o *GitLabBootstrapOptions) checkNamespace() error {
+	_, err := o.KubeClientSet.CoreV1().Namespaces().Get(o.serviceAccountNamespace(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("namespace %s not found, bootstrap with --create-namespace to create it", o.serviceAccountNamespace())
+	}
+	return err
+}
+
+// checkTokenScope reads the current user, which GitLab refuses for tokens scoped below api and read_user
+func (o *GitLabBootstrapOptions) checkTokenScope() error {
+	if _, _, err := o.GitLabAPI.Users.CurrentUser(gitlab.WithContext(o.ctx)); err != nil {
+		return wrapGitLabError(err, "unable to read the current GitLab user, the token needs the api scope")
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// usesClientCertAuth reports whether config authenticates to the API server with a client
+// certificate rather than a bearer token
+func usesClientCertAuth(config *restclient.Config) bool {
+	if config == nil {
+		return false
+	}
+	tls := config.TLSClientConfig
+	hasCert := len(tls.CertData) > 0 || tls.CertFile != ""
+	return hasCert && config.BearerToken == "" && config.BearerTokenFile == ""
+}
+
+// warnClientCertAuth explains, when the kubeconfig authenticates with a client certificate, that
+// GitLab only connects with the gitlab-admin bearer token and the certificate isn't forwarded
+func (o *GitLabBootstrapOptions) warnClientCertAuth() {
+	if usesClientCertAuth(o.RestConfig) {
+		fmt.Fprintf(o.ErrOut, "WARNING: the kubeconfig authenticates with a client certificate, which isn't forwarded to GitLab. GitLab only connects with the gitlab-admin ServiceAccount token, so the bootstrap can't go on without it\n")
+	}
+}
+
+// checkBearerToken ensures a ServiceAccount token was read before a cluster is registered, as
+// GitLab connects to the API server with a bearer token and nothing else
+func (o *GitLabBootstrapOptions) checkBearerToken() error {
+	if o.ServiceAccountToken != "" {
+		return nil
+	}
+	o.warnClientCertAuth()
+	return &Error{Stage: StageKube, Err: fmt.Errorf("no gitlab-admin ServiceAccount token to register, GitLab connects to the cluster with a bearer token")}
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// GitLabCluster is the subset of a GitLab project, group or instance cluster used by the plugin
+type GitLabCluster struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	EnvironmentScope string `json:"environment_scope"`
+	APIURL           string `json:"api_url"`
+	CaCert           string `json:"-"`
+	WebURL           string `json:"-"`
+}
+
+// ListGitLabClusters lists the clusters registered in the GitLab project, group or instance,
+// reading every page of the list
+func (o *GitLabBootstrapOptions) ListGitLabClusters() ([]GitLabCluster, error) {
+	var clusters []GitLabCluster
+	page := 1
+	for {
+		var resp *gitlab.Response
+		switch o.Target {
+		case TargetInstance:
+			ics, r, err := o.GitLabAPI.InstanceCluster.ListClusters(withPage(page), gitlab.WithContext(o.ctx))
+			if err != nil {
+				return nil, wrapGitLabError(err, "unable to list instance clusters")
+			}
+			for _, ic := range ics {
+				cluster := newGitLabCluster(ic.ID, ic.Name, ic.EnvironmentScope, ic.PlatformKubernetes)
+				cluster.WebURL = fmt.Sprintf("%s/admin/clusters/%d", o.gitlabWebURL(), ic.ID)
+				clusters = append(clusters, cluster)
+			}
+			resp = r
+		case TargetGroup:
+			gcs, r, err := o.GitLabAPI.GroupCluster.ListClusters(o.GitLabProjectID, withPage(page), gitlab.WithContext(o.ctx))
+			if err != nil {
+				return nil, wrapGitLabError(err, "unable to list group clusters")
+			}
+			for _, gc := range gcs {
+				cluster := newGitLabCluster(gc.ID, gc.Name, gc.EnvironmentScope, gc.PlatformKubernetes)
+				if gc.Group != nil {
+					cluster.WebURL = fmt.Sprintf("%s/-/clusters/%d", gc.Group.WebURL, gc.ID)
+				}
+				clusters = append(clusters, cluster)
+			}
+			resp = r
+		default:
+			pcs, r, err := o.GitLabAPI.ProjectCluster.ListClusters(o.GitLabProjectID, withPage(page), gitlab.WithContext(o.ctx))
+			if err != nil {
+				return nil, wrapGitLabError(err, "unable to list project clusters")
+			}
+			for _, pc := range pcs {
+				cluster := newGitLabCluster(pc.ID, pc.Name, pc.EnvironmentScope, pc.PlatformKubernetes)
+				if pc.Project != nil {
+					cluster.WebURL = fmt.Sprintf("%s/clusters/%d", pc.Project.WebURL, pc.ID)
+				}
+				clusters = append(clusters, cluster)
+			}
+			resp = r
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+	return clusters, nil
+}
+
+// withPage requests a page of 100 items from a list endpoint go-gitlab takes no ListOptions for
+func withPage(page int) gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		query := req.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", "100")
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+}
+
+func newGitLabCluster(id int, name, scope string, pk *gitlab.PlatformKubernetes) GitLabCluster {
+	cluster := GitLabCluster{ID: id, Name: name, EnvironmentScope: scope}
+	if pk != nil {
+		cluster.APIURL = pk.APIURL
+		cluster.CaCert = pk.CaCert
+	}
+	return cluster
+}
+
+// findRegisteredCluster returns a GitLab cluster with the same name and API URL as the one being added, or nil
+func (o *GitLabBootstrapOptions) findRegisteredCluster() (*GitLabCluster, error) {
+	clusters, err := o.ListGitLabClusters()
+	if err != nil {
+		return nil, err
+	}
+	for i := range clusters {
+		if clusters[i].Name == o.ClusterName && clusters[i].APIURL == o.ClusterHost {
+			return &clusters[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// EditGitLabCluster updates the base domain and Kubernetes settings of an existing GitLab cluster,
+// leaving nil fields untouched
+func (o *GitLabBootstrapOptions) EditGitLabCluster(id int, domain *string, platform *gitlab.EditPlatformKubernetesOptions) error {
+	var err error
+	switch o.Target {
+	case TargetInstance:
+		clusterOpts := &gitlab.EditClusterOptions{Domain: domain, PlatformKubernetes: platform}
+		_, _, err = o.GitLabAPI.InstanceCluster.EditCluster(id, clusterOpts, gitlab.WithContext(o.ctx))
+	case TargetGroup:
+		clusterOpts := &gitlab.EditGroupClusterOptions{
+			Domain: domain,
+			PlatformKubernetes: &gitlab.EditGroupPlatformKubernetesOptions{
+				APIURL: platform.APIURL,
+				Token:  platform.Token,
+				CaCert: platform.CaCert,
+			},
+		}
+		_, _, err = o.GitLabAPI.GroupCluster.EditCluster(o.GitLabProjectID, id, clusterOpts, gitlab.WithContext(o.ctx))
+	default:
+		clusterOpts := &gitlab.EditClusterOptions{Domain: domain, PlatformKubernetes: platform}
+		_, _, err = o.GitLabAPI.ProjectCluster.EditCluster(o.GitLabProjectID, id, clusterOpts, gitlab.WithContext(o.ctx))
+	}
+	return err
+}
+
+// DeleteGitLabCluster removes an existing cluster from GitLab
+func (o *GitLabBootstrapOptions) DeleteGitLabCluster(id int) error {
+	var err error
+	switch o.Target {
+	case TargetInstance:
+		_, err = o.GitLabAPI.InstanceCluster.DeleteCluster(id, gitlab.WithContext(o.ctx))
+	case TargetGroup:
+		_, err = o.GitLabAPI.GroupCluster.DeleteCluster(o.GitLabProjectID, id, gitlab.WithContext(o.ctx))
+	default:
+		_, err = o.GitLabAPI.ProjectCluster.DeleteCluster(o.GitLabProjectID, id, gitlab.WithContext(o.ctx))
+	}
+	return err
+}
+
+// FindGitLabCluster finds the GitLab cluster with the --cluster-id, or else the one matching the
+// cluster name. Several clusters with the name are an error, as GitLab doesn't keep names unique.
+func (o *GitLabBootstrapOptions) FindGitLabCluster() (*GitLabCluster, error) {
+	clusters, err := o.ListGitLabClusters()
+	if err != nil {
+		return nil, err
+	}
+	if o.GitLabClusterID != 0 {
+		for i := range clusters {
+			if clusters[i].ID == o.GitLabClusterID {
+				return &clusters[i], nil
+			}
+		}
+		return nil, &Error{Stage: StageGitLab, Err: fmt.Errorf("no cluster with id %d found in GitLab %s", o.GitLabClusterID, o.gitlabTargetKind())}
+	}
+	var matches []*GitLabCluster
+	var ids []string
+	for i := range clusters {
+		if clusters[i].Name == o.ClusterName {
+			matches = append(matches, &clusters[i])
+			ids = append(ids, strconv.Itoa(clusters[i].ID))
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return nil, &Error{Stage: StageValidate, Err: fmt.Errorf("multiple clusters named %q (ids %s), pass --cluster-id", o.ClusterName, strings.Join(ids, ", "))}
+	}
+	if o.Target == TargetInstance {
+		return nil, &Error{Stage: StageGitLab, Err: fmt.Errorf("no cluster named %q found in GitLab instance", o.ClusterName)}
+	}
+	return nil, &Error{Stage: StageGitLab, Err: fmt.Errorf("no cluster named %q found in GitLab %s %s", o.ClusterName, o.gitlabTargetKind(), o.GitLabProjectID)}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestListGitLabClustersPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/12345/clusters" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if perPage := r.URL.Query().Get("per_page"); perPage != "100" {
+			t.Errorf("got per_page %q, want 100", perPage)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 3 {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"id": %d, "name": "cluster-%d"}]`, page, page)
+	}))
+	defer server.Close()
+
+	o := newTestOptions()
+	o.ctx = context.Background()
+	o.GitLabURL = server.URL
+	o.GitLabAPIToken = "glpat-token"
+	o.GitLabProjectID = "12345"
+	api, err := o.newGitLabClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.GitLabAPI = api
+
+	clusters, err := o.ListGitLabClusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 3 || clusters[2].Name != "cluster-3" {
+		t.Errorf("got %+v, want the clusters of all 3 pages", clusters)
+	}
+}
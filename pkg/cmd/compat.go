@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// Minimum GitLab releases providing the cluster API used for each target
+const (
+	minProjectClusterMajor  = 11
+	minProjectClusterMinor  = 7
+	minGroupClusterMajor    = 12
+	minGroupClusterMinor    = 1
+	minInstanceClusterMajor = 13
+	minInstanceClusterMinor = 2
+)
+
+// getGitLabVersion gets the GitLab version like Version.GetVersion, which takes no request
+// options in this go-gitlab release, within the context of the run
+func (o *GitLabBootstrapOptions) getGitLabVersion() (*gitlab.Version, error) {
+	req, err := o.GitLabAPI.NewRequest(http.MethodGet, "version", nil, []gitlab.RequestOptionFunc{gitlab.WithContext(o.ctx)})
+	if err != nil {
+		return nil, err
+	}
+	version := new(gitlab.Version)
+	if _, err := o.GitLabAPI.Do(req, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// CheckGitLabVersion ensures the GitLab instance supports the cluster API of the chosen target.
+// Versions that can't be fetched or parsed are let through rather than blocking the bootstrap.
+func (o *GitLabBootstrapOptions) CheckGitLabVersion() error {
+	version, err := o.getGitLabVersion()
+	if err != nil {
+		if o.Verbose {
+			fmt.Fprintf(o.ErrOut, "Unable to get GitLab version, skipping compatibility check: %v\n", err)
+		}
+		return nil
+	}
+	major, minor, ok := parseGitLabVersion(version.Version)
+	if !ok {
+		return nil
+	}
+
+	wantMajor, wantMinor := minProjectClusterMajor, minProjectClusterMinor
+	switch o.Target {
+	case TargetInstance:
+		wantMajor, wantMinor = minInstanceClusterMajor, minInstanceClusterMinor
+	case TargetGroup:
+		wantMajor, wantMinor = minGroupClusterMajor, minGroupClusterMinor
+	}
+	if !versionAtLeast(major, minor, wantMajor, wantMinor) {
+		return &Error{Stage: StageGitLab, Err: fmt.Errorf("your GitLab version %s does not support %s clusters, GitLab %d.%d or newer is required", version.Version, o.gitlabTargetKind(), wantMajor, wantMinor)}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// completionTimeout bounds the API server call behind a dynamic completion so a TAB never hangs
+const completionTimeout = 5 * time.Second
+
+// completeNamesCmd is the hidden subcommand listing contexts or namespaces for the bash script.
+// cobra reserves __complete for the Go completions fish uses.
+const completeNamesCmd = "__complete-names"
+
+// bashCompletionFunctions complete --context and --namespace through the hidden __complete-names
+// subcommand, passing on the kubeconfig flags already on the command line
+const bashCompletionFunctions = `__gitlab-bootstrap_override_flags()
+{
+    local i word
+    for ((i = 1; i < ${#words[@]}; i++)); do
+        word=${words[i]}
+        case "${word}" in
+            --kubeconfig=*|--context=*|--cluster=*|--user=*)
+                echo -n "${word} "
+                ;;
+            --kubeconfig|--context|--cluster|--user)
+                echo -n "${word}=${words[i+1]} "
+                ;;
+        esac
+    done
+}
+
+__gitlab-bootstrap_complete()
+{
+    local out
+    if out=$("${words[0]}" __complete-names "$1" $(__gitlab-bootstrap_override_flags) 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out[*]}" -- "$cur" ) )
+    fi
+}
+
+__gitlab-bootstrap_get_contexts()
+{
+    __gitlab-bootstrap_complete contexts
+}
+
+__gitlab-bootstrap_get_namespaces()
+{
+    __gitlab-bootstrap_complete namespaces
+}
+`
+
+// registerCompletions hooks the dynamic completions up to the root command and its flags, as
+// bash functions for the bash script and as Go functions for the fish one
+func (o *GitLabBootstrapOptions) registerCompletions(cmd *cobra.Command) {
+	cmd.BashCompletionFunction = bashCompletionFunctions
+	cobra.MarkFlagCustom(cmd.PersistentFlags(), "context", "__gitlab-bootstrap_get_contexts")
+	cobra.MarkFlagCustom(cmd.PersistentFlags(), "namespace", "__gitlab-bootstrap_get_namespaces")
+	cmd.RegisterFlagCompletionFunc("context", o.completeNamesFunc("contexts"))
+	cmd.RegisterFlagCompletionFunc("namespace", o.completeNamesFunc("namespaces"))
+}
+
+// completeNamesFunc completes a flag with the kubeconfig contexts or cluster namespaces
+func (o *GitLabBootstrapOptions) completeNamesFunc(kind string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		names, err := o.completionNames(kind)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// NewCmdCompletion creates and returns the completion subcommand
+func NewCmdCompletion(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion bash|zsh|fish",
+		Short: "Prints a shell completion script",
+		Long: `Prints a shell completion script. Load it in the current shell with
+
+  source <(kubectl-gitlab_bootstrap completion bash)
+
+or for fish
+
+  kubectl-gitlab_bootstrap completion fish | source
+
+--context and --namespace complete from the kubeconfig and the cluster.`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.WriteCompletion(c.Root(), args[0])
+		},
+	}
+
+	return cmd
+}
+
+// WriteCompletion writes the completion script of root for shell to Out
+func (o *GitLabBootstrapOptions) WriteCompletion(root *cobra.Command, shell string) error {
+	switch shell {
+	case "bash":
+		return o.writeBashCompletion(root)
+	case "zsh":
+		// cobra's native zsh script can't run the dynamic completions, zsh runs the bash one instead
+		fmt.Fprintln(o.Out, "autoload -U +X compinit && compinit")
+		fmt.Fprintln(o.Out, "autoload -U +X bashcompinit && bashcompinit")
+		return o.writeBashCompletion(root)
+	case "fish":
+		return o.writeFishCompletion(root)
+	default:
+		return fmt.Errorf("unsupported shell %q, must be one of bash, zsh or fish", shell)
+	}
+}
+
+// writeBashCompletion writes the bash completion script of root, completing both the
+// gitlab-bootstrap name cobra knows and the kubectl-gitlab_bootstrap binary name
+func (o *GitLabBootstrapOptions) writeBashCompletion(root *cobra.Command) error {
+	var buf bytes.Buffer
+	if err := root.GenBashCompletion(&buf); err != nil {
+		return err
+	}
+	fmt.Fprintf(&buf, "complete -o default -F __start_%s kubectl-gitlab_bootstrap\n", root.Name())
+	_, err := buf.WriteTo(o.Out)
+	return err
+}
+
+// writeFishCompletion writes the fish completion script of root, completing the
+// kubectl-gitlab_bootstrap binary name too like writeBashCompletion does
+func (o *GitLabBootstrapOptions) writeFishCompletion(root *cobra.Command) error {
+	var buf bytes.Buffer
+	if err := root.GenFishCompletion(&buf, true); err != nil {
+		return err
+	}
+	fmt.Fprintf(&buf, "complete -c kubectl-gitlab_bootstrap -n 'set --query __%[1]s_comp_do_file_comp'\n", root.Name())
+	fmt.Fprintf(&buf, "complete -c kubectl-gitlab_bootstrap -n '__%[1]s_prepare_completions' -f -a '$__%[1]s_comp_results'\n", root.Name())
+	_, err := buf.WriteTo(o.Out)
+	return err
+}
+
+// NewCmdComplete creates and returns the hidden __complete-names subcommand the completion script
+// calls to list kubeconfig contexts or cluster namespaces
+func NewCmdComplete(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       completeNamesCmd + " contexts|namespaces",
+		Hidden:    true,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"contexts", "namespaces"},
+		RunE: func(c *cobra.Command, args []string) error {
+			names, err := o.completionNames(args[0])
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				fmt.Fprintln(o.Out, name)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// completionNames lists the kubeconfig contexts or the namespaces of the selected cluster
+func (o *GitLabBootstrapOptions) completionNames(kind string) ([]string, error) {
+	var names []string
+	switch kind {
+	case "contexts":
+		api, err := o.ConfigFlags.ToRawKubeConfigLoader().RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		for name := range api.Contexts {
+			names = append(names, name)
+		}
+	case "namespaces":
+		config, err := o.ConfigFlags.ToRESTConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Timeout = completionTimeout
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		namespaces, err := clientset.CoreV1().Namespaces().List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces.Items {
+			names = append(names, namespace.Name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported completion %q, must be one of contexts or namespaces", kind)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompletionFish(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "script",
+			args: []string{"completion", "fish"},
+			want: []string{
+				"complete -c gitlab-bootstrap -n '__gitlab-bootstrap_prepare_completions'",
+				"complete -c kubectl-gitlab_bootstrap -n '__gitlab-bootstrap_prepare_completions'",
+			},
+		},
+		{
+			// What the fish script runs to complete --context
+			name: "contexts",
+			args: []string{"__complete", "--kubeconfig", kubeconfig, "--context", ""},
+			want: []string{"test\n:4\n"},
+		},
+		{
+			name: "bash contexts",
+			args: []string{completeNamesCmd, "--kubeconfig", kubeconfig, "contexts"},
+			want: []string{"test\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			cmd := newCmdGitLabBootstrap(o)
+			cmd.SetOut(o.Out)
+			cmd.SetErr(o.ErrOut)
+			cmd.SetArgs(tt.args)
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			out := o.Out.(*bytes.Buffer).String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
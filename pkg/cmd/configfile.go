@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/yaml"
+)
+
+// envFallbacks are flags with environment variable fallbacks, which win over the config file
+var envFallbacks = map[string][]string{
+	"gitlab-api-token": {"GITLAB_API_TOKEN"},
+	"gitlab-url":       {"GITLAB_URL", "CI_SERVER_URL"},
+	"project-id":       ciProjectEnv,
+	"project-path":     ciProjectEnv,
+}
+
+// ciProjectEnv are the variables of the GitLab CI job's project, ignored with --no-ci-project
+var ciProjectEnv = []string{"CI_PROJECT_ID", "CI_PROJECT_PATH"}
+
+// envFallbackSet reports whether an environment variable fallback of the named flag is set
+func envFallbackSet(name string, noCIProject bool) bool {
+	if noCIProject && (name == "project-id" || name == "project-path") {
+		return false
+	}
+	for _, env := range envFallbacks[name] {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultConfigFile returns ~/.config/kubectl-gitlab_bootstrap.yaml
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "kubectl-gitlab_bootstrap.yaml")
+}
+
+// hasFlag reports whether cmd or any of its subcommands defines the named flag
+func hasFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if hasFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfigFile sets flags that weren't given on the command line from the YAML config file,
+// whose keys are flag names. Precedence: flag > env > config file > default. The values replace
+// the flag defaults without marking the flags changed, so they don't count as given on the
+// command line, e.g. an environment-scope from the file doesn't conflict with --environment.
+func (o *GitLabBootstrapOptions) loadConfigFile(cmd *cobra.Command) error {
+	path := o.ConfigFile
+	if path == "" {
+		path = defaultConfigFile()
+		if _, err := os.Stat(path); path == "" || os.IsNotExist(err) {
+			return nil
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to read config file")
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse config file %s", path)
+	}
+
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	// Keep project ids and other numbers as written instead of float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return errors.Wrapf(err, "config file %s must be a map of flag names to values", path)
+	}
+
+	// --no-ci-project may itself come from the file and decides whether the CI project wins
+	noCIProject := o.NoCIProject
+	if value, ok := values["no-ci-project"]; ok && !cmd.Flags().Changed("no-ci-project") {
+		noCIProject = fmt.Sprint(value) == "true"
+	}
+	for name, value := range values {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			// The file is shared by every subcommand, skip flags that belong to another one
+			if !hasFlag(cmd.Root(), name) {
+				return fmt.Errorf("unknown flag %q in config file %s", name, path)
+			}
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		if envFallbackSet(name, noCIProject) {
+			continue
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if err := flag.Value.Set(fmt.Sprint(item)); err != nil {
+				return errors.Wrapf(err, "invalid value for %q in config file %s", name, path)
+			}
+		}
+		flag.DefValue = flag.Value.String()
+	}
+	return nil
+}
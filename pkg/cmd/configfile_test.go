@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// setenv sets the environment variables in env, returning a func restoring the previous values
+func setenv(env map[string]string) func() {
+	previous := map[string]*string{}
+	for name, value := range env {
+		if old, ok := os.LookupEnv(name); ok {
+			previous[name] = &old
+		} else {
+			previous[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, old := range previous {
+			if old == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *old)
+			}
+		}
+	}
+}
+
+func TestConfigFileEnvPrecedence(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+	configFile, cleanup := writeTempFile(t, `gitlab-url: https://config.example.com
+project-id: "111"
+gitlab-api-token: config-token
+`)
+	defer cleanup()
+	noCIConfigFile, cleanup := writeTempFile(t, `project-id: "111"
+no-ci-project: true
+`)
+	defer cleanup()
+
+	tests := []struct {
+		name          string
+		configFile    string
+		args          []string
+		env           map[string]string
+		wantGitLabURL string
+		wantProjectID string
+	}{
+		{name: "config file", configFile: configFile, wantGitLabURL: "https://config.example.com", wantProjectID: "111"},
+		{
+			name:          "GITLAB_URL over config file",
+			configFile:    configFile,
+			env:           map[string]string{"GITLAB_URL": "https://env.example.com"},
+			wantGitLabURL: "https://env.example.com",
+			wantProjectID: "111",
+		},
+		{
+			name:          "CI job over config file",
+			configFile:    configFile,
+			env:           map[string]string{"CI_SERVER_URL": "https://ci.example.com", "CI_PROJECT_ID": "222"},
+			wantGitLabURL: "https://ci.example.com",
+			wantProjectID: "222",
+		},
+		{
+			name:          "flags over CI job",
+			configFile:    configFile,
+			args:          []string{"--gitlab-url", "https://flag.example.com", "--project-id", "333"},
+			env:           map[string]string{"CI_SERVER_URL": "https://ci.example.com", "CI_PROJECT_ID": "222"},
+			wantGitLabURL: "https://flag.example.com",
+			wantProjectID: "333",
+		},
+		{
+			name:          "no-ci-project in config file",
+			configFile:    noCIConfigFile,
+			env:           map[string]string{"CI_PROJECT_ID": "222"},
+			wantProjectID: "111",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"GITLAB_URL": "", "CI_SERVER_URL": "", "CI_PROJECT_ID": "", "CI_PROJECT_PATH": "", "GITLAB_API_TOKEN": ""}
+			for name, value := range tt.env {
+				env[name] = value
+			}
+			defer setenv(env)()
+
+			o := newTestOptions()
+			cmd := newCmdGitLabBootstrap(o)
+			if err := cmd.ParseFlags(append([]string{"--config", tt.configFile, "--kubeconfig", kubeconfig}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if err := o.Complete(cmd, cmd.Flags().Args()); err != nil {
+				t.Fatal(err)
+			}
+			if o.GitLabURL != tt.wantGitLabURL {
+				t.Errorf("GitLab URL is %q, want %q", o.GitLabURL, tt.wantGitLabURL)
+			}
+			if o.GitLabProjectID != tt.wantProjectID {
+				t.Errorf("project id is %q, want %q", o.GitLabProjectID, tt.wantProjectID)
+			}
+		})
+	}
+}
+
+func TestConfigFileValuesAreDefaults(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+	configFile, cleanup := writeTempFile(t, `environment-scope: staging
+gitlab-api-token: config-token
+`)
+	defer cleanup()
+
+	// The file's values aren't given on the command line, so flags they would conflict with win
+	tests := []struct {
+		name                 string
+		args                 []string
+		stdin                string
+		wantEnvironmentScope string
+		wantToken            string
+	}{
+		{name: "config file", wantEnvironmentScope: "staging", wantToken: "config-token"},
+		{name: "token stdin", args: []string{"--gitlab-api-token-stdin"}, stdin: "stdin-token", wantEnvironmentScope: "staging", wantToken: "stdin-token"},
+		{name: "environment", args: []string{"--environment", "production"}, wantEnvironmentScope: "production", wantToken: "config-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setenv(map[string]string{"GITLAB_API_TOKEN": ""})()
+			o := newTestOptions()
+			o.In = bytes.NewBufferString(tt.stdin)
+			cmd := newCmdGitLabBootstrap(o)
+			if err := cmd.ParseFlags(append([]string{"--config", configFile, "--no-ci-project", "--kubeconfig", kubeconfig, "12345"}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if err := o.Complete(cmd, cmd.Flags().Args()); err != nil {
+				t.Fatal(err)
+			}
+			if o.EnvironmentScope != tt.wantEnvironmentScope {
+				t.Errorf("environment scope is %q, want %q", o.EnvironmentScope, tt.wantEnvironmentScope)
+			}
+			if o.GitLabAPIToken != tt.wantToken {
+				t.Errorf("GitLab token is %q, want %q", o.GitLabAPIToken, tt.wantToken)
+			}
+		})
+	}
+}
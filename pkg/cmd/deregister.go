@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdDeregister creates and returns the deregister subcommand
+func NewCmdDeregister(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deregister [project id]",
+		Short: "Removes the cluster from GitLab, leaving the gitlab-admin ServiceAccount and ClusterRoleBinding in place",
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.requireSingleTarget(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.Validate(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.Deregister(); err != nil {
+				return o.explainRevokedToken(err)
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().IntVar(&o.GitLabClusterID, "cluster-id", 0, "Id of the GitLab cluster to remove, whatever its name. Needed when several clusters share the kubeconfig cluster name")
+	cmd.Flags().BoolVarP(&o.Yes, "yes", "y", false, "Don't ask for confirmation")
+	o.addErrorOutputFlag(cmd)
+
+	return cmd
+}
+
+// Deregister deletes the GitLab cluster with the --cluster-id, or else the one matching the cluster name.
+// Nothing in the Kubernetes cluster is touched.
+func (o *GitLabBootstrapOptions) Deregister() error {
+	cluster, err := o.FindGitLabCluster()
+	if err != nil {
+		return err
+	}
+
+	if !o.Yes && !o.confirm(fmt.Sprintf("Remove cluster %s (id %d) from GitLab %s?", cluster.Name, cluster.ID, o.gitlabTargetKind())) {
+		return &Error{Stage: StageValidate, Err: fmt.Errorf("removing cluster %s aborted", cluster.Name)}
+	}
+	if err := o.DeleteGitLabCluster(cluster.ID); err != nil {
+		return wrapGitLabError(err, "unable to remove cluster from GitLab")
+	}
+	o.infof("Cluster %s removed from GitLab %s, the gitlab-admin ServiceAccount and ClusterRoleBinding were left in place\n", cluster.Name, o.gitlabTargetKind())
+	return nil
+}
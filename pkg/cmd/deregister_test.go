@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDeregisterSameNamedClusters(t *testing.T) {
+	tests := []struct {
+		name      string
+		clusterID int
+		wantID    int
+		wantErr   string
+	}{
+		{name: "by name", wantErr: `multiple clusters named "prod" (ids 1, 2), pass --cluster-id`},
+		{name: "by id", clusterID: 2, wantID: 2},
+		{name: "unknown id", clusterID: 3, wantErr: "no cluster with id 3 found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeGitLab(t.Logf)
+			defer server.Close()
+			fake.clusters["projects/12345"] = []*fakeCluster{
+				{ID: 1, Name: "prod", EnvironmentScope: "*"},
+				{ID: 2, Name: "prod", EnvironmentScope: "production"},
+			}
+
+			o := newTestOptions()
+			o.ctx = context.Background()
+			o.GitLabURL = server.URL
+			o.GitLabAPIToken = "glpat-token"
+			o.GitLabProjectID = "12345"
+			o.ClusterName = "prod"
+			o.GitLabClusterID = tt.clusterID
+			o.Yes = true
+			api, err := o.newGitLabClient("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.GitLabAPI = api
+
+			err = o.Deregister()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if clusters := fake.clusters["projects/12345"]; len(clusters) != 2 {
+					t.Errorf("got %d clusters left, want 2", len(clusters))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			clusters := fake.clusters["projects/12345"]
+			if len(clusters) != 1 || clusters[0].ID == tt.wantID {
+				t.Errorf("cluster %d wasn't the only one removed, left %+v", tt.wantID, clusters)
+			}
+			if errOut := o.ErrOut.(*bytes.Buffer).String(); !strings.Contains(errOut, "Cluster prod removed") {
+				t.Errorf("missing removal message in %q", errOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessGrant is a ClusterRoleBinding granting the gitlab-admin ServiceAccount a ClusterRole
+type AccessGrant struct {
+	Binding     string              `json:"binding"`
+	ClusterRole string              `json:"cluster_role"`
+	Rules       []rbacv1.PolicyRule `json:"rules"`
+}
+
+// NewCmdDescribeAccess creates and returns the describe-access subcommand
+func NewCmdDescribeAccess(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe-access",
+		Short: "Prints the cluster wide permissions granted to the gitlab-admin ServiceAccount",
+		Args:  cobra.NoArgs,
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.CheckClusterReachable(); err != nil {
+				return err
+			}
+			if err := o.DescribeAccess(); err != nil {
+				return err
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "Output format. One of: json")
+
+	return cmd
+}
+
+// DescribeAccess prints the ClusterRoleBindings referencing the gitlab-admin ServiceAccount and the rules they grant
+func (o *GitLabBootstrapOptions) DescribeAccess() error {
+	grants, err := o.ListAccessGrants()
+	if err != nil {
+		return err
+	}
+
+	switch o.Output {
+	case "json":
+		if grants == nil {
+			grants = []AccessGrant{}
+		}
+		data, err := json.MarshalIndent(grants, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal access")
+		}
+		fmt.Fprintln(o.Out, string(data))
+	case "":
+		if len(grants) == 0 {
+			fmt.Fprintf(o.Out, "ServiceAccount %s/gitlab-admin is not bound to any ClusterRole\n", o.serviceAccountNamespace())
+			return nil
+		}
+		for _, grant := range grants {
+			fmt.Fprintf(o.Out, "ClusterRoleBinding %s grants ClusterRole %s:\n", grant.Binding, grant.ClusterRole)
+			w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "  VERBS\tAPI GROUPS\tRESOURCES\tNON-RESOURCE URLS")
+			for _, rule := range grant.Rules {
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", joinRuleField(rule.Verbs), joinRuleField(rule.APIGroups), joinRuleField(rule.Resources), joinRuleField(rule.NonResourceURLs))
+			}
+			w.Flush()
+		}
+	default:
+		return classifyError(fmt.Errorf("unsupported output format %q", o.Output), StageValidate)
+	}
+	return nil
+}
+
+// ListAccessGrants resolves the ClusterRoles bound to the gitlab-admin ServiceAccount
+func (o *GitLabBootstrapOptions) ListAccessGrants() ([]AccessGrant, error) {
+	crbs, err := o.KubeClientSet.RbacV1().ClusterRoleBindings().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, wrapKubeError(err, "unable to list clusterrolebindings")
+	}
+
+	var grants []AccessGrant
+	for _, crb := range crbs.Items {
+		if !bindsServiceAccount(crb.Subjects, o.serviceAccountNamespace(), "gitlab-admin") || crb.RoleRef.Kind != "ClusterRole" {
+			continue
+		}
+		role, err := o.KubeClientSet.RbacV1().ClusterRoles().Get(crb.RoleRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, wrapKubeError(err, fmt.Sprintf("unable to get clusterrole %s", crb.RoleRef.Name))
+		}
+		grants = append(grants, AccessGrant{Binding: crb.Name, ClusterRole: role.Name, Rules: role.Rules})
+	}
+	return grants, nil
+}
+
+// bindsServiceAccount reports whether subjects include the named ServiceAccount
+func bindsServiceAccount(subjects []rbacv1.Subject, namespace, name string) bool {
+	for _, subject := range subjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == namespace && subject.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func joinRuleField(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
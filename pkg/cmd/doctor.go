@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// diagnosis is one doctor check with the hint printed when it fails
+type diagnosis struct {
+	title string
+	hint  string
+	run   func() error
+}
+
+// NewCmdDoctor creates and returns the doctor subcommand
+func NewCmdDoctor(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnoses common kubeconfig, cluster and GitLab misconfigurations",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.Doctor(c)
+		},
+	}
+
+	return cmd
+}
+
+// Doctor runs the Kubernetes and the GitLab diagnoses, printing a checklist with a hint for each
+// failure. Within each group, checks after a failure are skipped as they build on it.
+func (o *GitLabBootstrapOptions) Doctor(cmd *cobra.Command) error {
+	if err := o.loadConfigFile(cmd); err != nil {
+		return classifyError(err, StageValidate)
+	}
+	loader := o.ConfigFlags.ToRawKubeConfigLoader()
+
+	kube := []diagnosis{
+		{"Kubeconfig found", "set KUBECONFIG or pass --kubeconfig", func() error {
+			files := loader.ConfigAccess().GetLoadingPrecedence()
+			if *o.ConfigFlags.KubeConfig != "" {
+				files = []string{*o.ConfigFlags.KubeConfig}
+			}
+			for _, file := range files {
+				if _, err := os.Stat(file); err == nil {
+					return nil
+				}
+			}
+			return fmt.Errorf("no kubeconfig at %s", strings.Join(files, ", "))
+		}},
+		{"Kubeconfig parses", "fix the kubeconfig, kubectl config view shows where it fails", func() error {
+			api, err := loader.RawConfig()
+			if err != nil {
+				return err
+			}
+			o.KubeAPI = &api
+			return nil
+		}},
+		{"Current context points at a cluster", "pick a context with kubectl config use-context or pass --context or --cluster", func() error {
+			return o.completeClusterName(o.KubeAPI)
+		}},
+		{"Cluster CA present", "pass --cluster-ca-file, or --ca-from-cluster to read it from the cluster", func() error {
+			config, err := loader.ClientConfig()
+			if err != nil {
+				return err
+			}
+			o.RestConfig = config
+			o.ClusterHost = config.Host
+			if len(config.TLSClientConfig.CAData) == 0 && config.TLSClientConfig.CAFile == "" {
+				return fmt.Errorf("the kubeconfig cluster has no certificate-authority")
+			}
+			return nil
+		}},
+		{"Kubernetes cluster is reachable", "check the network path to the API server, e.g. a VPN, and --request-timeout", func() error {
+			if err := o.completeKubeClientSet(); err != nil {
+				return err
+			}
+			return o.CheckClusterReachable()
+		}},
+		{"Token mode fits the Kubernetes version", "use --token-mode auto, Kubernetes 1.24 and later don't create token secrets", func() error {
+			if o.TokenMode != TokenModeSecret {
+				return nil
+			}
+			// Ask what auto would pick for this cluster
+			o.TokenMode = TokenModeAuto
+			defer func() { o.TokenMode = TokenModeSecret }()
+			mode, err := o.resolveTokenMode()
+			if err != nil {
+				return err
+			}
+			if mode == tokenModeCreatedSecret {
+				return fmt.Errorf("--token-mode %s waits for a token secret Kubernetes no longer creates", TokenModeSecret)
+			}
+			return nil
+		}},
+	}
+
+	gitlabChecks := []diagnosis{
+		{"GitLab token found", "pass --gitlab-api-token, --gitlab-api-token-stdin or set GITLAB_API_TOKEN", func() error {
+			if err := o.completeGitLabAuth(cmd); err != nil {
+				return err
+			}
+			if o.GitLabAPIToken == "" {
+				return fmt.Errorf("no GitLab API token")
+			}
+			return nil
+		}},
+		{"GitLab is reachable", "check --gitlab-url, and HTTPS_PROXY and NO_PROXY if GitLab is behind a proxy", func() error {
+			return o.checkGitLabReachable()
+		}},
+		{"GitLab token is valid with the api scope", "create a personal access token with the api scope, the current one is invalid, expired or under-scoped", func() error {
+			api, err := o.newGitLabClient(o.GitLabSudo)
+			if err != nil {
+				return err
+			}
+			o.GitLabAPI = api
+			_, _, err = o.GitLabAPI.Users.CurrentUser(gitlab.WithContext(o.ctx))
+			return err
+		}},
+	}
+
+	healthy := o.diagnose(kube)
+	if !o.diagnose(gitlabChecks) {
+		healthy = false
+	}
+	if !healthy {
+		return &Error{Stage: StageValidate, Err: fmt.Errorf("doctor found problems")}
+	}
+	return nil
+}
+
+// diagnose runs checks in order and reports whether all of them passed
+func (o *GitLabBootstrapOptions) diagnose(checks []diagnosis) bool {
+	for i, check := range checks {
+		if err := check.run(); err != nil {
+			fmt.Fprintf(o.Out, "FAIL  %s: %v\n      hint: %s\n", check.title, err, check.hint)
+			for _, skipped := range checks[i+1:] {
+				fmt.Fprintf(o.Out, "SKIP  %s\n", skipped.title)
+			}
+			return false
+		}
+		fmt.Fprintf(o.Out, "PASS  %s\n", check.title)
+	}
+	return true
+}
+
+// checkGitLabReachable sends an unauthenticated request to the GitLab API through the same
+// transport, and so the same proxy settings, as the GitLab client. Any HTTP answer will do.
+func (o *GitLabBootstrapOptions) checkGitLabReachable() error {
+	gitlabURL := o.GitLabURL
+	if gitlabURL == "" {
+		gitlabURL = "https://gitlab.com"
+	}
+	req, err := http.NewRequest(http.MethodGet, gitlabAPIURL(gitlabURL)+"version", nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid GitLab URL")
+	}
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return errors.Wrap(err, "invalid proxy settings")
+	}
+	resp, err := newGitLabHTTPClient(o.UserAgent, "").Do(req.WithContext(o.ctx))
+	if err != nil {
+		if proxy != nil {
+			return errors.Wrapf(err, "unable to reach GitLab through proxy %s", proxy.Host)
+		}
+		return errors.Wrap(err, "unable to reach GitLab")
+	}
+	resp.Body.Close()
+	if o.Verbose && proxy != nil {
+		fmt.Fprintf(o.ErrOut, "Reached GitLab through proxy %s\n", proxy.Host)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// EnsureGitLabEnvironment makes sure Environment exists in the GitLab project, creating it
+// with CreateEnvironment. The cluster is tied to it through its environment scope.
+func (o *GitLabBootstrapOptions) EnsureGitLabEnvironment() error {
+	opts := &gitlab.ListEnvironmentsOptions{PerPage: 100}
+	for {
+		environments, resp, err := o.GitLabAPI.Environments.ListEnvironments(o.GitLabProjectID, opts, gitlab.WithContext(o.ctx))
+		if err != nil {
+			return wrapGitLabError(err, "unable to list project environments")
+		}
+		for _, environment := range environments {
+			if environment.Name == o.Environment {
+				return nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	if !o.CreateEnvironment {
+		return &Error{Stage: StageGitLab, Err: fmt.Errorf("environment %q not found in project %s, pass --create-environment to create it", o.Environment, o.GitLabProjectID)}
+	}
+	_, _, err := o.GitLabAPI.Environments.CreateEnvironment(o.GitLabProjectID, &gitlab.CreateEnvironmentOptions{
+		Name: &o.Environment,
+	}, gitlab.WithContext(o.ctx))
+	if err != nil {
+		return wrapGitLabError(err, fmt.Sprintf("unable to create environment %s", o.Environment))
+	}
+	o.infof("Created environment %s\n", o.Environment)
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnvironmentCheckedBeforeClusterAdd(t *testing.T) {
+	tests := []struct {
+		name              string
+		environments      []string
+		createEnvironment bool
+		wantErr           bool
+	}{
+		{name: "existing", environments: []string{"staging", "production"}},
+		{name: "created", createEnvironment: true},
+		{name: "missing", environments: []string{"staging"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeGitLab(t.Logf)
+			defer server.Close()
+			fake.environments["12345"] = tt.environments
+
+			o := newTestOptions()
+			o.ctx = context.Background()
+			o.GitLabURL = server.URL
+			o.GitLabAPIToken = "glpat-token"
+			o.GitLabProjectID = "12345"
+			o.ClusterName = "prod"
+			o.ClusterHost = "https://k8s.example.com:6443"
+			o.ServiceAccountToken = "sa-token"
+			o.Environment = "production"
+			o.EnvironmentScope = "production"
+			o.CreateEnvironment = tt.createEnvironment
+			api, err := o.newGitLabClient("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.GitLabAPI = api
+
+			err = o.AddClusterToGitLab()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for the missing environment")
+				}
+				if clusters := fake.clusters["projects/12345"]; len(clusters) != 0 {
+					t.Errorf("cluster was added before the environment check failed: %+v", clusters[0])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clusters := fake.clusters["projects/12345"]; len(clusters) != 1 {
+				t.Errorf("got %d clusters, want 1", len(clusters))
+			}
+			var found bool
+			for _, name := range fake.environments["12345"] {
+				found = found || name == "production"
+			}
+			if !found {
+				t.Errorf("environment production missing from %q", fake.environments["12345"])
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// Stage identifies the part of the plugin a failure happened in
+type Stage string
+
+const (
+	// StageValidate covers configuration and validation failures
+	StageValidate Stage = "validate"
+	// StageKube covers Kubernetes API failures
+	StageKube Stage = "kube"
+	// StageGitLab covers GitLab API failures
+	StageGitLab Stage = "gitlab"
+)
+
+// Error is a failure tagged with the stage it happened in
+type Error struct {
+	Stage Stage
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode maps the stage of the failure to a process exit code
+func (e *Error) ExitCode() int {
+	switch e.Stage {
+	case StageValidate:
+		return 2
+	case StageKube:
+		return 3
+	case StageGitLab:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// jsonError is how a failure is written to ErrOut with -o json
+type jsonError struct {
+	Error string `json:"error"`
+	Stage Stage  `json:"stage,omitempty"`
+	Code  int    `json:"code"`
+}
+
+// withJSONErrors wraps a RunE so that with -o json a failure is written to ErrOut as a JSON
+// object with its stage and exit code, in place of cobra's error and usage, for pipelines to
+// parse. Other output formats keep the human readable error.
+func (o *GitLabBootstrapOptions) withJSONErrors(run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(c *cobra.Command, args []string) error {
+		err := run(c, args)
+		if err == nil || o.Output != "json" {
+			return err
+		}
+		body := jsonError{Error: err.Error(), Code: 1}
+		var cmdErr *Error
+		if errors.As(err, &cmdErr) {
+			body.Stage = cmdErr.Stage
+			body.Code = cmdErr.ExitCode()
+		}
+		if encodeErr := json.NewEncoder(o.ErrOut).Encode(body); encodeErr == nil {
+			c.SilenceErrors = true
+			c.SilenceUsage = true
+		}
+		return err
+	}
+}
+
+// addErrorOutputFlag adds -o to a subcommand that prints no result, so that -o json still writes
+// its failures as JSON through withJSONErrors
+func (o *GitLabBootstrapOptions) addErrorOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "Output format of failures. One of: json")
+	cmd.PreRunE = func(c *cobra.Command, args []string) error {
+		if o.Output != "" && o.Output != "json" {
+			return classifyError(fmt.Errorf("unsupported output format %q", o.Output), StageValidate)
+		}
+		return nil
+	}
+}
+
+// TokenSecretNotFoundError means no token secret exists for the ServiceAccount. Kubernetes 1.24 and
+// newer no longer create one automatically.
+type TokenSecretNotFoundError struct {
+	Namespace      string
+	ServiceAccount string
+	// Secret is the --token-secret that was looked for, empty when the ServiceAccount's secrets were searched
+	Secret string
+}
+
+func (e *TokenSecretNotFoundError) Error() string {
+	what := fmt.Sprintf("no token secret found for serviceaccount %s/%s", e.Namespace, e.ServiceAccount)
+	if e.Secret != "" {
+		what = fmt.Sprintf("token secret %s/%s not found", e.Namespace, e.Secret)
+	}
+	return what + ". Kubernetes 1.24+ doesn't create token secrets automatically, request a token with --token-audience or create a secret of type kubernetes.io/service-account-token and pass it with --token-secret"
+}
+
+// TokenRevokedError means GitLab refused the API token after it had been validated, so it most
+// likely expired or was revoked during the run rather than lacking permissions
+type TokenRevokedError struct {
+	Err error
+}
+
+func (e *TokenRevokedError) Error() string {
+	return fmt.Sprintf("GitLab API token appears to have expired or been revoked since it was validated: %v", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *TokenRevokedError) Unwrap() error {
+	return e.Err
+}
+
+// explainRevokedToken turns a GitLab 401 after Validate succeeded into a TokenRevokedError
+func (o *GitLabBootstrapOptions) explainRevokedToken(err error) error {
+	var errResp *gitlab.ErrorResponse
+	if err == nil || !o.gitlabValidated || !errors.As(err, &errResp) || errResp.Response == nil || errResp.Response.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+	return &Error{Stage: StageGitLab, Err: &TokenRevokedError{Err: err}}
+}
+
+// classifyError tags err with stage unless it already carries one
+func classifyError(err error, stage Stage) error {
+	var stageErr *Error
+	if errors.As(err, &stageErr) {
+		return err
+	}
+	return &Error{Stage: stage, Err: err}
+}
+
+// wrapKubeError wraps a Kubernetes API failure
+func wrapKubeError(err error, message string) error {
+	return &Error{Stage: StageKube, Err: errors.Wrap(err, message)}
+}
+
+// wrapGitLabError wraps a GitLab API failure
+func wrapGitLabError(err error, message string) error {
+	if rateLimited := rateLimitMessage(err); rateLimited != "" {
+		message = message + ", " + rateLimited
+	}
+	return &Error{Stage: StageGitLab, Err: errors.Wrap(err, message)}
+}
+
+// wrapGitLabValidationError wraps a GitLab API failure, replacing the raw response with the
+// field errors GitLab reported if it rejected the request as invalid
+func wrapGitLabValidationError(err error, message string) error {
+	fieldErrors := gitlabFieldErrors(err)
+	if len(fieldErrors) == 0 {
+		return wrapGitLabError(err, message)
+	}
+	return &Error{Stage: StageGitLab, Err: errors.Errorf("%s: %s", message, strings.Join(fieldErrors, "; "))}
+}
+
+// gitlabFieldErrors returns the field validation errors of a GitLab 400 response, e.g.
+// {"message":{"name":["has already been taken"]}} becomes "name has already been taken"
+func gitlabFieldErrors(err error) []string {
+	errResp, ok := err.(*gitlab.ErrorResponse)
+	if !ok || errResp.Response == nil || errResp.Response.StatusCode != http.StatusBadRequest {
+		return nil
+	}
+
+	var body struct {
+		Message map[string][]string `json:"message"`
+	}
+	if json.Unmarshal(errResp.Body, &body) != nil {
+		return nil
+	}
+
+	var fieldErrors []string
+	for field, messages := range body.Message {
+		for _, m := range messages {
+			fieldErrors = append(fieldErrors, fmt.Sprintf("%s %s", field, m))
+		}
+	}
+	sort.Strings(fieldErrors)
+	return fieldErrors
+}
+
+// gitlabResponse returns the HTTP response of a GitLab API error or nil if there is none
+func gitlabResponse(err error) *http.Response {
+	if errResp, ok := err.(*gitlab.ErrorResponse); ok {
+		return errResp.Response
+	}
+	return nil
+}
+
+// gitlabStatusCode returns the HTTP status code of a GitLab API error or 0 if there is none
+func gitlabStatusCode(err error) int {
+	if resp := gitlabResponse(err); resp != nil {
+		return resp.StatusCode
+	}
+	return 0
+}
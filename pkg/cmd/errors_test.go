@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestJSONErrors(t *testing.T) {
+	for _, subcommand := range []string{"rotate", "update-ca", "deregister", "check"} {
+		t.Run(subcommand, func(t *testing.T) {
+			o := newTestOptions()
+			cmd := newCmdGitLabBootstrap(o)
+			cmd.SetOutput(o.ErrOut)
+			cmd.SetArgs([]string{subcommand, "--config", os.DevNull, "--no-ci-project", "--kubeconfig", "does-not-exist", "-o", "json", "12345"})
+			if err := cmd.Execute(); err == nil {
+				t.Fatal("expected a missing kubeconfig to fail")
+			}
+
+			var body jsonError
+			if err := json.Unmarshal(o.ErrOut.(*bytes.Buffer).Bytes(), &body); err != nil {
+				t.Fatalf("stderr isn't a JSON error: %v\n%s", err, o.ErrOut)
+			}
+			if body.Stage != StageValidate || body.Code != 2 || body.Error == "" {
+				t.Errorf("got %+v, want a validate failure with code 2", body)
+			}
+		})
+	}
+}
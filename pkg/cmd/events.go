@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RecordEvent records a GitLabBootstrapped Event on the gitlab-admin ServiceAccount as an audit trail
+func (o *GitLabBootstrapOptions) RecordEvent() error {
+	namespace := o.serviceAccountNamespace()
+	sa, err := o.KubeClientSet.CoreV1().ServiceAccounts(namespace).Get("gitlab-admin", metav1.GetOptions{})
+	if err != nil {
+		return wrapKubeError(err, "unable to get serviceaccount")
+	}
+
+	var target string
+	switch {
+	case o.Target == TargetInstance:
+		target = "the GitLab instance"
+	case len(o.GitLabProjectIDs) > 1:
+		target = fmt.Sprintf("GitLab %ss %s", o.gitlabTargetKind(), strings.Join(o.GitLabProjectIDs, ", "))
+	default:
+		target = fmt.Sprintf("GitLab %s %s", o.gitlabTargetKind(), o.GitLabProjectID)
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "gitlab-admin.",
+			Namespace:    namespace,
+			Labels:       map[string]string{ManagedByLabel: ManagedByValue},
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "ServiceAccount",
+			Name:            sa.Name,
+			Namespace:       sa.Namespace,
+			UID:             sa.UID,
+			ResourceVersion: sa.ResourceVersion,
+		},
+		Reason:              "GitLabBootstrapped",
+		Message:             fmt.Sprintf("ServiceAccount gitlab-admin and ClusterRoleBinding %s set up by %s to register cluster %s in %s", o.clusterRoleBindingName(), ManagedByValue, o.ClusterName, target),
+		Type:                v1.EventTypeNormal,
+		Source:              v1.EventSource{Component: ManagedByValue},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: ManagedByValue,
+	}
+	if _, err := o.KubeClientSet.CoreV1().Events(namespace).Create(event); err != nil {
+		return wrapKubeError(err, "unable to record event")
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeGitLabVersion is reported by the fake GitLab, new enough for every cluster type
+const fakeGitLabVersion = "13.12.0-fake"
+
+// fakeGitLab is an in-memory stand-in for the GitLab API endpoints the plugin uses. It accepts
+// any token and id, keeps the clusters added to it and logs every call.
+type fakeGitLab struct {
+	mu           sync.Mutex
+	url          string
+	logf         func(format string, args ...interface{})
+	nextID       int
+	clusters     map[string][]*fakeCluster
+	environments map[string][]string
+}
+
+type fakeCluster struct {
+	ID                 int                    `json:"id"`
+	Name               string                 `json:"name"`
+	Domain             string                 `json:"domain"`
+	EnvironmentScope   string                 `json:"environment_scope"`
+	PlatformKubernetes fakePlatformKubernetes `json:"platform_kubernetes"`
+	Project            *fakeOwner             `json:"project,omitempty"`
+	Group              *fakeOwner             `json:"group,omitempty"`
+}
+
+type fakePlatformKubernetes struct {
+	APIURL string `json:"api_url"`
+	Token  string `json:"-"`
+	CaCert string `json:"ca_cert"`
+}
+
+type fakeOwner struct {
+	ID     int    `json:"id"`
+	WebURL string `json:"web_url"`
+}
+
+// fakeClusterRequest is the body of an add or edit cluster request
+type fakeClusterRequest struct {
+	Name               *string `json:"name"`
+	Domain             *string `json:"domain"`
+	EnvironmentScope   *string `json:"environment_scope"`
+	PlatformKubernetes *struct {
+		APIURL *string `json:"api_url"`
+		Token  *string `json:"token"`
+		CaCert *string `json:"ca_cert"`
+	} `json:"platform_kubernetes_attributes"`
+}
+
+// newFakeGitLab starts serving an empty fake GitLab, logging calls to logf
+func newFakeGitLab(logf func(format string, args ...interface{})) (*fakeGitLab, *httptest.Server) {
+	fake := &fakeGitLab{
+		logf:         logf,
+		clusters:     map[string][]*fakeCluster{},
+		environments: map[string][]string{},
+	}
+	server := httptest.NewServer(fake)
+	fake.url = server.URL
+	return fake, server
+}
+
+// startFakeGitLab serves a fake GitLab for the rest of the process and points the options at it
+func (o *GitLabBootstrapOptions) startFakeGitLab() {
+	_, server := newFakeGitLab(o.infof)
+	o.GitLabURL = server.URL
+	o.GitLabAPIToken = "fake"
+	o.infof("Using a fake GitLab at %s, nothing is sent to a real GitLab\n", server.URL)
+}
+
+func (f *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logf("fake GitLab: %s %s\n", r.Method, r.URL.EscapedPath())
+
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), gitlabAPIPath), "/"), "/") {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			unescaped = part
+		}
+		parts = append(parts, unescaped)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "version":
+		f.write(w, http.StatusOK, map[string]string{"version": fakeGitLabVersion, "revision": "fake"})
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "user":
+		f.write(w, http.StatusOK, map[string]interface{}{"id": 1, "username": "fake", "is_admin": true})
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "projects":
+		f.write(w, http.StatusOK, []interface{}{})
+	case r.Method == http.MethodGet && len(parts) == 2 && (parts[0] == "projects" || parts[0] == "groups"):
+		owner := f.owner(parts[0], parts[1])
+		f.write(w, http.StatusOK, map[string]interface{}{"id": owner.ID, "path_with_namespace": parts[1], "full_path": parts[1], "web_url": owner.WebURL})
+	case len(parts) >= 3 && parts[0] == "projects" && parts[2] == "environments":
+		f.serveEnvironments(w, r, parts[1])
+	case len(parts) >= 3 && (parts[0] == "projects" || parts[0] == "groups") && parts[2] == "clusters":
+		f.serveClusters(w, r, parts[0], parts[1], parts[3:])
+	case len(parts) >= 2 && parts[0] == "admin" && parts[1] == "clusters":
+		f.serveClusters(w, r, "admin", "", parts[2:])
+	default:
+		f.write(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// serveClusters handles the list, add, edit and delete cluster endpoints of a project, group or the instance
+func (f *fakeGitLab) serveClusters(w http.ResponseWriter, r *http.Request, kind, id string, rest []string) {
+	key := kind + "/" + id
+	switch {
+	case r.Method == http.MethodGet && len(rest) == 0:
+		clusters := f.clusters[key]
+		if clusters == nil {
+			clusters = []*fakeCluster{}
+		}
+		f.write(w, http.StatusOK, clusters)
+	case r.Method == http.MethodPost && len(rest) == 1 && (rest[0] == "user" || rest[0] == "add"):
+		var req fakeClusterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.write(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		f.nextID++
+		cluster := &fakeCluster{ID: f.nextID, EnvironmentScope: "*"}
+		switch kind {
+		case "projects":
+			cluster.Project = f.owner(kind, id)
+		case "groups":
+			cluster.Group = f.owner(kind, id)
+		}
+		req.apply(cluster)
+		f.clusters[key] = append(f.clusters[key], cluster)
+		f.write(w, http.StatusCreated, cluster)
+	case len(rest) == 1:
+		clusterID, _ := strconv.Atoi(rest[0])
+		for i, cluster := range f.clusters[key] {
+			if cluster.ID != clusterID {
+				continue
+			}
+			switch r.Method {
+			case http.MethodPut:
+				var req fakeClusterRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					f.write(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+					return
+				}
+				req.apply(cluster)
+				f.write(w, http.StatusOK, cluster)
+			case http.MethodDelete:
+				f.clusters[key] = append(f.clusters[key][:i], f.clusters[key][i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				f.write(w, http.StatusOK, cluster)
+			}
+			return
+		}
+		f.write(w, http.StatusNotFound, map[string]string{"message": "404 Cluster Not Found"})
+	default:
+		f.write(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// serveEnvironments handles listing and creating the environments of a project
+func (f *fakeGitLab) serveEnvironments(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		environments := []map[string]interface{}{}
+		for i, name := range f.environments[id] {
+			environments = append(environments, map[string]interface{}{"id": i + 1, "name": name})
+		}
+		f.write(w, http.StatusOK, environments)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.write(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		f.environments[id] = append(f.environments[id], req.Name)
+		f.write(w, http.StatusCreated, map[string]interface{}{"id": len(f.environments[id]), "name": req.Name})
+	default:
+		f.write(w, http.StatusNotFound, map[string]string{"message": "404 Not Found"})
+	}
+}
+
+// owner returns a synthetic project or group for id
+func (f *fakeGitLab) owner(kind, id string) *fakeOwner {
+	numericID, err := strconv.Atoi(id)
+	if err != nil {
+		numericID = 1
+	}
+	if kind == "groups" {
+		return &fakeOwner{ID: numericID, WebURL: fmt.Sprintf("%s/groups/%s", f.url, id)}
+	}
+	return &fakeOwner{ID: numericID, WebURL: fmt.Sprintf("%s/%s", f.url, id)}
+}
+
+func (f *fakeGitLab) write(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// apply copies the fields set in the request onto cluster
+func (req fakeClusterRequest) apply(cluster *fakeCluster) {
+	if req.Name != nil {
+		cluster.Name = *req.Name
+	}
+	if req.Domain != nil {
+		cluster.Domain = *req.Domain
+	}
+	if req.EnvironmentScope != nil {
+		cluster.EnvironmentScope = *req.EnvironmentScope
+	}
+	if pk := req.PlatformKubernetes; pk != nil {
+		if pk.APIURL != nil {
+			cluster.PlatformKubernetes.APIURL = *pk.APIURL
+		}
+		if pk.Token != nil {
+			cluster.PlatformKubernetes.Token = *pk.Token
+		}
+		if pk.CaCert != nil {
+			cluster.PlatformKubernetes.CaCert = *pk.CaCert
+		}
+	}
+}
@@ -1,18 +1,30 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
-	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/pkg/errors"
 
 	"github.com/spf13/cobra"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	v1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/validation/path"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
@@ -25,26 +37,118 @@ import (
 // Version of the plugin
 const Version = "1.0.0"
 
+const (
+	// ManagedByLabel is stamped on every object the plugin creates
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue identifies the plugin as the manager of an object
+	ManagedByValue = "kubectl-gitlab_bootstrap"
+	// PlatformKubernetes is the GitLab cluster platform the plugin registers
+	PlatformKubernetes = "kubernetes"
+)
+
+const (
+	defaultTokenWaitTimeout  = 30 * time.Second
+	defaultTokenPollInterval = time.Second
+	// tokenPollJitter spreads polls up to 50% past the interval
+	tokenPollJitter = 0.5
+	// tokenSecretPrefix starts the names the token controller gives gitlab-admin token secrets
+	tokenSecretPrefix = "gitlab-admin-token-"
+
+	// gitlabAPIPath is where the GitLab REST API lives below the instance root
+	gitlabAPIPath = "/api/v4"
+)
+
+const bootstrapExample = `  # Bootstrap the current cluster into GitLab project 12345
+  kubectl gitlab-bootstrap 12345 --gitlab-api-token <token>
+
+  # Bootstrap the current cluster into a GitLab group
+  kubectl gitlab-bootstrap my-group --target group --gitlab-api-token <token>
+
+  # Bootstrap into a project on a self-managed GitLab
+  kubectl gitlab-bootstrap my-group/my-project --gitlab-url https://gitlab.example.com --gitlab-api-token <token>
+
+  # Read the token from the environment instead of the command line
+  export GITLAB_API_TOKEN=<token>
+  kubectl gitlab-bootstrap 12345`
+
 // GitLabBootstrapOptions holds configs used to make requests
 type GitLabBootstrapOptions struct {
 	ConfigFlags *genericclioptions.ConfigFlags
 
-	GitLabAPIToken  string
-	GitLabProjectID string
+	Config
 
+	// KubeConfig is the kubeconfig file in use, --kubeconfig, else the first existing KUBECONFIG
+	// entry, else ~/.kube/config, following kubectl's precedence
 	KubeConfig    string
-	RestConfig    *restclient.Config
 	KubeAPI       *clientcmdapi.Config
-	KubeClientSet *kubernetes.Clientset
-
-	ClusterName string
-	ClusterHost string
-	ClusterCA   string
+	KubeClientSet kubernetes.Interface
 
 	ServiceAccountToken string
 
+	LabelArgs        []string
+	AnnotationArgs   []string
+	ExtraSubjectArgs []string
+	// ManagedFlag is --managed, the inverse of Unmanaged
+	ManagedFlag bool
+
+	ProjectIDFlag []string
+	GroupIDFlag   string
+	ProjectPath   string
+	// NoCIProject stops falling back to the project of the GitLab CI job when no id is given
+	NoCIProject bool
+
+	// FakeGitLab swaps GitLab for an in-memory fake, for demos and trying the plugin out
+	FakeGitLab bool
+
+	UserAgent      string
+	ClusterAPIURL  string
+	GitLabSudo     string
+	TokenFromStdin bool
+	InCluster      bool
+	ConfigFile     string
+
+	AlsoToken bool
+	AlsoURL   bool
+	MergeCA   bool
+
+	// GitLabClusterID picks the GitLab cluster by id instead of by the kubeconfig cluster name
+	GitLabClusterID int
+
+	ScopeFromNamespace bool
+	ClusterCAFile      string
+	CAFromCluster      bool
+
+	AllowNoCA bool
+	NoHints   bool
+	Verbose   bool
+	Quiet     bool
+	Output    string
+
+	OutputFile     string
+	OptionsFile    string
+	outputFormat   string
+	optionsOverlay []byte
+	outputTemplate *template.Template
+	FailFast       bool
+	// Concurrency is how many GitLab projects or groups the cluster is added to at a time
+	Concurrency int
+
+	// gitlabValidated is set once an authenticated GitLab call in Validate succeeded with the token,
+	// so a later 401 means it was revoked rather than never valid
+	gitlabValidated bool
+
+	// GitLabProjectIDs are all the GitLab ids given. GitLabProjectID is the one being worked on
+	GitLabProjectIDs []string
+	TargetResults    []TargetResult
+
+	EmitPayload string
+
 	GitLabAPI *gitlab.Client
 
+	Result Result
+
+	ctx context.Context
+
 	genericclioptions.IOStreams
 }
 
@@ -52,204 +156,1221 @@ type GitLabBootstrapOptions struct {
 func NewGitLabBootstrapOptions(streams genericclioptions.IOStreams) *GitLabBootstrapOptions {
 	return &GitLabBootstrapOptions{
 		ConfigFlags: genericclioptions.NewConfigFlags(true),
+		ctx:         context.Background(),
 		IOStreams:   streams,
 	}
 }
 
 // NewCmdGitLabBootstrap creates and returns a new command
 func NewCmdGitLabBootstrap(streams genericclioptions.IOStreams) *cobra.Command {
-	o := NewGitLabBootstrapOptions(streams)
+	return newCmdGitLabBootstrap(NewGitLabBootstrapOptions(streams))
+}
 
+// newCmdGitLabBootstrap creates the root command and its subcommands around o
+func newCmdGitLabBootstrap(o *GitLabBootstrapOptions) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "gitlab-bootstrap [project id]",
-		Short:   "Bootstraps a Kubernetes cluster into a GitLab project",
-		Version: Version,
-		RunE: func(c *cobra.Command, args []string) error {
+		Use:   "gitlab-bootstrap [project id...]",
+		Short: "Bootstraps a Kubernetes cluster into a GitLab project or group",
+		Long: `Bootstraps a Kubernetes cluster into a GitLab project or group.
+
+Exit codes:
+  1  unexpected error
+  2  configuration or validation error
+  3  Kubernetes API error
+  4  GitLab API error
+
+With -o json a failure is written to stderr as
+  {"error": "...", "stage": "validate|kube|gitlab", "code": N}
+where code is the exit code.`,
+		Example: bootstrapExample,
+		Version: versionString(),
+		Args:    cobra.ArbitraryArgs,
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
 			if err := o.Complete(c, args); err != nil {
-				return err
+				return classifyError(err, StageValidate)
+			}
+			if err := o.completeResultOutput(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if o.EmitPayload != "" && o.EmitPayload != "json" && o.EmitPayload != "yaml" {
+				return classifyError(fmt.Errorf("unsupported payload format %q", o.EmitPayload), StageValidate)
 			}
-			if err := o.Validate(); err != nil {
+			if o.EmitPayload != "" && o.printsResult() {
+				return classifyError(fmt.Errorf("--emit-payload can't be combined with --output or --output-file"), StageValidate)
+			}
+			if o.Concurrency < 1 {
+				return classifyError(fmt.Errorf("--concurrency must be at least 1"), StageValidate)
+			}
+			if o.Concurrency > 1 && o.Replace && !o.Yes {
+				return classifyError(fmt.Errorf("--replace with --concurrency needs --yes, confirmations can't be asked in parallel"), StageValidate)
+			}
+			result, err := o.bootstrap(context.Background())
+			if o.printsResult() && len(o.GitLabProjectIDs) > 1 && o.TargetResults != nil {
+				// Report which targets succeeded even if some failed
+				if printErr := o.PrintResult(o.TargetResults); printErr != nil {
+					return printErr
+				}
 				return err
 			}
-			if err := o.Run(); err != nil {
+			if err != nil {
 				return err
 			}
+			if o.printsResult() {
+				return o.PrintResult(result)
+			}
 			return nil
-		},
+		}),
 	}
 
-	cmd.Flags().StringVar(&o.GitLabAPIToken, "gitlab-api-token", "", "Private token from GitLab. Pulled from env[\"GITLAB_API_TOKEN\"] if not provided")
-	o.ConfigFlags.AddFlags(cmd.Flags())
+	cmd.PersistentFlags().StringVar(&o.GitLabAPIToken, "gitlab-api-token", "", "Private token from GitLab. Pulled from env[\"GITLAB_API_TOKEN\"] if not provided. Not needed with --skip-register or --emit-payload, which don't call GitLab")
+	cmd.PersistentFlags().StringVar(&o.ConfigFile, "config", "", "YAML file of flag names to default values. Defaults to ~/.config/kubectl-gitlab_bootstrap.yaml if it exists")
+	cmd.PersistentFlags().BoolVar(&o.TokenFromStdin, "gitlab-api-token-stdin", false, "Read the GitLab private token from stdin")
+	cmd.PersistentFlags().StringVar(&o.GitLabURL, "gitlab-url", "", "URL of a self-managed GitLab instance, including its subpath if served under one like https://host/gitlab. Pulled from env[\"GITLAB_URL\"] or env[\"CI_SERVER_URL\"] if not provided. Defaults to https://gitlab.com")
+	cmd.PersistentFlags().StringVar(&o.GitLabSudo, "gitlab-sudo", "", "Make the GitLab API requests as this user id or username. Needs an admin token")
+	cmd.PersistentFlags().StringVar(&o.UserAgent, "user-agent", defaultUserAgent, "User-Agent header sent with GitLab API requests")
+	cmd.PersistentFlags().StringArrayVar(&o.ProjectIDFlag, "project-id", nil, "GitLab project id, as an alternative to the positional arg. Can be repeated to bootstrap several projects")
+	cmd.PersistentFlags().StringVar(&o.ProjectPath, "project-path", "", "Full GitLab project path like group/sub/project, resolved to its id. Matched ignoring case when the exact path isn't found")
+	cmd.PersistentFlags().BoolVar(&o.NoCIProject, "no-ci-project", false, "Don't fall back to env[\"CI_PROJECT_ID\"], then env[\"CI_PROJECT_PATH\"], when no project id is given")
+	cmd.PersistentFlags().StringVar(&o.GroupIDFlag, "group-id", "", "GitLab group id, as an alternative to the positional arg. Implies --target group")
+	cmd.PersistentFlags().StringVar(&o.Target, "target", "", "Kind of GitLab cluster to add. One of: project, group, instance. The id is a project id or path, a group id or path, or omitted for instance. Defaults to project")
+	cmd.PersistentFlags().BoolVar(&o.GitLabUseGroup, "gitlab-use-group", false, "Treat the id as a GitLab group id instead of a project id")
+	cmd.PersistentFlags().MarkDeprecated("gitlab-use-group", "use --target group instead")
+	cmd.PersistentFlags().BoolVar(&o.GitLabInstance, "gitlab-instance", false, "Same as --target instance")
+	cmd.PersistentFlags().StringVar(&o.TokenMode, "token-mode", TokenModeAuto, "How to get the ServiceAccount token. One of: auto, secret, request. auto reads the token secret, creating one on Kubernetes 1.24 and later")
+	cmd.PersistentFlags().StringVar(&o.TokenSecret, "token-secret", "", "Name of the ServiceAccount token secret to read. Defaults to the newest gitlab-admin token secret")
+	cmd.PersistentFlags().BoolVar(&o.NoPreflight, "no-preflight", false, "Skip the GitLab version and admin probes for networks where only the required endpoints are reachable")
+	cmd.PersistentFlags().BoolVar(&o.FakeGitLab, "fake-gitlab", false, "Talk to an in-memory fake GitLab instead of a real one")
+	cmd.PersistentFlags().MarkHidden("fake-gitlab")
+	cmd.PersistentFlags().StringVar(&o.ClusterAPIURL, "cluster-api-url", "", "API server URL to register in GitLab instead of the one in the kubeconfig, e.g. a name the API server certificate is valid for. May include the path prefix of a reverse proxy in front of the API server")
+	cmd.PersistentFlags().BoolVar(&o.AllowInsecureClusterURL, "allow-insecure-cluster-url", false, "Register an http:// API server URL, which GitLab rejects outside of local testing")
+	cmd.PersistentFlags().BoolVar(&o.AllowPrivateClusterURL, "allow-private-cluster-url", false, "Register a localhost or private network API server URL on gitlab.com, which can't reach it")
+	cmd.PersistentFlags().BoolVar(&o.StrictTLS, "strict-tls", false, "Fail instead of warning when the API server certificate doesn't validate for the registered URL with the cluster CA")
+	cmd.PersistentFlags().BoolVar(&o.SkipTargetCheck, "skip-target-check", false, "Don't check the GitLab project or group exists before using it. A wrong id then only fails at the cluster API, after the Kubernetes objects were created")
+	cmd.PersistentFlags().BoolVarP(&o.Quiet, "quiet", "q", false, "Suppress informational output. Errors, warnings and -o output are still printed")
+	cmd.PersistentFlags().BoolVar(&o.Verbose, "verbose", false, "Print additional details about each step, and how long it took, to stderr")
+	cmd.PersistentFlags().StringVar(&o.ClusterCAFile, "cluster-ca-file", "", "Path to a PEM or base64 encoded PEM CA certificate to register instead of the kubeconfig CA")
+	cmd.PersistentFlags().StringVar(&o.TokenAudience, "token-audience", "", "Request a bound ServiceAccount token for this audience through the TokenRequest API instead of reading a token secret. Implies --token-mode request")
+	cmd.PersistentFlags().DurationVar(&o.TokenDuration, "token-duration", 0, "Requested lifetime of a --token-mode request token. Defaults to the API server's default")
+	cmd.PersistentFlags().StringVar(&o.ExpectClusterName, "expect-cluster-name", "", "Abort unless the kubeconfig cluster has this name. Guards against bootstrapping the wrong cluster")
+	cmd.PersistentFlags().BoolVar(&o.InCluster, "in-cluster", false, "Use the pod's ServiceAccount config instead of a kubeconfig. Detected automatically when there is no kubeconfig. Requires --cluster")
+	cmd.PersistentFlags().DurationVar(&o.TokenWaitTimeout, "token-wait-timeout", defaultTokenWaitTimeout, "How long to wait for the token controller to populate the ServiceAccount token secret")
+	cmd.PersistentFlags().DurationVar(&o.TokenPollInterval, "token-poll-interval", defaultTokenPollInterval, "Base interval between checks for the ServiceAccount token secret. Jittered up to 50%")
+	cmd.PersistentFlags().BoolVar(&o.CAFromCluster, "ca-from-cluster", false, "Read the cluster CA from the kube-root-ca.crt configmap, published on Kubernetes 1.20 and later, instead of the kubeconfig")
+	cmd.PersistentFlags().BoolVar(&o.AllowNoCA, "allow-no-ca", false, "Allow registering a cluster whose kubeconfig has no CA certificate")
+	cmd.Flags().StringVar(&o.EnvironmentScope, "environment-scope", "*", "GitLab environment scope of the cluster")
+	cmd.Flags().StringVar(&o.Environment, "environment", "", "GitLab project environment to use the cluster for. Sets the environment scope to it")
+	cmd.Flags().BoolVar(&o.CreateEnvironment, "create-environment", false, "Create the --environment in the GitLab project if it doesn't exist")
+	cmd.Flags().BoolVar(&o.ScopeFromNamespace, "scope-from-namespace", false, "Use the namespace of the current context, or --namespace, as the environment scope. An explicit --environment-scope wins")
+	cmd.Flags().StringVar(&o.ClusterRoleBindingName, "cluster-role-binding-name", "", "Name of the ClusterRoleBinding granting cluster-admin. Defaults to gitlab-admin, the ServiceAccount name")
+	cmd.Flags().StringVar(&o.OptionsFile, "options-file", "", "YAML file of GitLab add cluster API options, like management_project_id, filling in the ones not set by flags")
+	cmd.Flags().StringArrayVar(&o.AnnotationArgs, "annotation", nil, "Annotation in key=value form to add to the created ServiceAccount and ClusterRoleBinding, e.g. a ticket number. Can be repeated")
+	cmd.Flags().StringArrayVar(&o.LabelArgs, "label", nil, "Label in key=value form to add to the created ServiceAccount and ClusterRoleBinding. Can be repeated")
+	cmd.Flags().StringVar(&o.ClusterDomain, "cluster-domain", "", "Base domain of the cluster in GitLab, used by Auto DevOps")
+	cmd.Flags().StringVar(&o.Platform, "platform", PlatformKubernetes, "Platform of the cluster in GitLab. Only kubernetes is supported")
+	cmd.Flags().BoolVar(&o.SkipServiceAccount, "skip-service-account", false, "Don't create the gitlab-admin ServiceAccount, it is managed elsewhere")
+	cmd.Flags().BoolVar(&o.SkipClusterRoleBinding, "skip-cluster-role-binding", false, "Don't create the gitlab-admin ClusterRoleBinding, it is managed elsewhere")
+	cmd.Flags().BoolVar(&o.SkipRegister, "skip-register", false, "Only create the Kubernetes objects, don't register the cluster in GitLab")
+	cmd.Flags().BoolVar(&o.CreateNamespaceIfMissing, "create-namespace", false, "Create the --namespace of the ServiceAccount if it doesn't exist")
+	cmd.Flags().StringArrayVar(&o.ExtraSubjectArgs, "extra-subject", nil, "Additional ClusterRoleBinding subject in kind=...,name=...,namespace=... form. Kind is one of ServiceAccount, User or Group. Can be repeated")
+	cmd.Flags().StringVar(&o.WriteKubeConfig, "write-kubeconfig", "", "Path to write a standalone kubeconfig using the gitlab-admin ServiceAccount token")
+	cmd.Flags().StringVar(&o.AuthorizationType, "authorization-type", AuthorizationRBAC, "How the cluster authorizes the namespaces and service accounts GitLab creates for a GitLab-managed cluster. One of: rbac, abac, unknown_authorization")
+	cmd.Flags().StringVar(&o.ProjectNamespace, "project-namespace", "", "Namespace GitLab deploys the project to. Only for project clusters, GitLab picks one per environment by default")
+	cmd.Flags().BoolVar(&o.ManagedFlag, "managed", true, "Register the cluster as GitLab-managed. GitLab will then create namespaces and service accounts for each project on its own")
+	cmd.Flags().BoolVar(&o.PrintToken, "print-token", false, "Print the ServiceAccount token to stdout for debugging. This exposes a sensitive credential")
+	cmd.Flags().BoolVar(&o.Force, "force", false, "Recreate the gitlab-admin ClusterRoleBinding if its roleRef or subjects drifted, and take over fields owned by other field managers")
+	cmd.Flags().StringVar(&o.FieldManager, "field-manager", ManagedByValue, "Field manager used to server-side apply the ServiceAccount and ClusterRoleBinding. Ignored before Kubernetes 1.16, where they are created or merge patched instead")
+	cmd.Flags().BoolVar(&o.Replace, "replace", false, "Delete a GitLab cluster with the same name before adding it. Asks for confirmation unless --yes is set")
+	cmd.Flags().BoolVar(&o.WaitForBinding, "wait-for-binding", false, "Wait up to 30s for the ClusterRoleBinding, see --cluster-role-binding-name, to be effective before registering the cluster")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "Output format for the registered cluster. One of: json, yaml, go-template=..., go-template-file=...")
+	cmd.Flags().StringVar(&o.OutputFile, "output-file", "", "Write the registered cluster to this file, with mode 0600, instead of stdout. Uses the -o format, or yaml for a .yaml or .yml file and json otherwise")
+	cmd.Flags().StringVar(&o.EmitPayload, "emit-payload", "", "Create the Kubernetes objects, then print the GitLab add cluster payload in this format instead of registering the cluster. One of: json, yaml")
+	cmd.Flags().Lookup("emit-payload").NoOptDefVal = "json"
+	cmd.Flags().BoolVar(&o.Record, "record", false, "Record a GitLabBootstrapped Event on the gitlab-admin ServiceAccount")
+	cmd.Flags().BoolVar(&o.FailFast, "fail-fast", false, "Stop at the first GitLab project or group the cluster can't be added to")
+	cmd.Flags().IntVar(&o.Concurrency, "concurrency", 1, "How many GitLab projects or groups to add the cluster to in parallel when several ids are given")
+	cmd.Flags().BoolVar(&o.NoHints, "no-hints", false, "Don't print next steps after registering the cluster")
+	cmd.Flags().BoolVarP(&o.Yes, "yes", "y", false, "Skip confirmations and warnings for sensitive operations")
+	o.ConfigFlags.AddFlags(cmd.PersistentFlags())
+	o.registerCompletions(cmd)
+
+	cmd.AddCommand(NewCmdRotate(o))
+	cmd.AddCommand(NewCmdList(o))
+	cmd.AddCommand(NewCmdUpdateCA(o))
+	cmd.AddCommand(NewCmdDescribeAccess(o))
+	cmd.AddCommand(NewCmdCheck(o))
+	cmd.AddCommand(NewCmdDeregister(o))
+	cmd.AddCommand(NewCmdDoctor(o))
+	cmd.AddCommand(NewCmdVersion(o))
+	cmd.AddCommand(NewCmdCompletion(o))
+	cmd.AddCommand(NewCmdComplete(o))
 
 	return cmd
 }
 
 // Complete sets all configs required
 func (o *GitLabBootstrapOptions) Complete(cmd *cobra.Command, args []string) error {
-	if len(args) != 1 {
-		return fmt.Errorf("GitLab project id is required")
+	if err := o.loadConfigFile(cmd); err != nil {
+		return err
+	}
+	if err := o.completeGitLabTarget(args); err != nil {
+		return err
+	}
+	if err := o.completeGitLabAuth(cmd); err != nil {
+		return err
 	}
-	o.GitLabProjectID = args[0]
 
-	if o.GitLabAPIToken == "" {
-		o.GitLabAPIToken = os.Getenv("GITLAB_API_TOKEN")
+	o.Labels = map[string]string{}
+	for _, label := range o.LabelArgs {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid label %q, expected key=value", label)
+		}
+		if errs := validation.IsQualifiedName(parts[0]); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", parts[0], strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(parts[1]); len(errs) > 0 {
+			return fmt.Errorf("invalid label value %q: %s", parts[1], strings.Join(errs, "; "))
+		}
+		o.Labels[parts[0]] = parts[1]
+	}
+	o.Annotations = map[string]string{}
+	for _, annotation := range o.AnnotationArgs {
+		parts := strings.SplitN(annotation, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid annotation %q, expected key=value", annotation)
+		}
+		// Annotation keys follow the label key rules, ignoring case
+		if errs := validation.IsQualifiedName(strings.ToLower(parts[0])); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation key %q: %s", parts[0], strings.Join(errs, "; "))
+		}
+		o.Annotations[parts[0]] = parts[1]
+	}
+	if o.OptionsFile != "" {
+		if err := o.loadOptionsFile(cmd.Flags()); err != nil {
+			return err
+		}
+	}
+	o.Unmanaged = !o.ManagedFlag
+	for _, arg := range o.ExtraSubjectArgs {
+		subject, err := parseSubject(arg)
+		if err != nil {
+			return err
+		}
+		o.ExtraSubjects = append(o.ExtraSubjects, subject)
 	}
 
-	// Grab KubeConfig from flag or home dir
-	if *o.ConfigFlags.KubeConfig != "" {
-		o.KubeConfig = *o.ConfigFlags.KubeConfig
+	// Load the kubeconfig once through ConfigFlags so --kubeconfig, KUBECONFIG and its merge
+	// rules, and the override flags apply to both the raw config and the RestConfig
+	loader := o.ConfigFlags.ToRawKubeConfigLoader()
+	o.KubeConfig = loader.ConfigAccess().GetDefaultFilename()
+	var config *restclient.Config
+	var err error
+	if o.InCluster || o.detectInCluster(loader) {
+		config, err = o.completeInCluster()
+		if err != nil {
+			return err
+		}
 	} else {
-		home, err := os.UserHomeDir()
+		api, err := loader.RawConfig()
 		if err != nil {
-			return errors.Wrap(err, "can't get home dir")
+			return errors.Wrap(err, "error loading kubeconfig")
 		}
+		o.KubeAPI = &api
 
-		o.KubeConfig = filepath.Join(home, ".kube", "config")
-	}
-	config, err := clientcmd.BuildConfigFromFlags("", o.KubeConfig)
-	if err != nil {
-		return errors.Wrap(err, "error building config from kubeconfig path")
+		if err := o.completeClusterName(o.KubeAPI); err != nil {
+			return err
+		}
+
+		config, err = loader.ClientConfig()
+		if err != nil {
+			return errors.Wrap(err, "error building config from kubeconfig path")
+		}
 	}
 	o.RestConfig = config
 	o.ClusterHost = config.Host
-	o.ClusterCA = string(config.TLSClientConfig.CAData)
+	if o.ClusterAPIURL != "" {
+		// Kept as given, API servers behind a reverse proxy are often served under a path prefix
+		apiURL, err := url.Parse(o.ClusterAPIURL)
+		if err != nil || (apiURL.Scheme != "https" && apiURL.Scheme != "http") || apiURL.Host == "" {
+			return fmt.Errorf("invalid --cluster-api-url %q, expected a URL like https://host[:port][/path]", o.ClusterAPIURL)
+		}
+		o.ClusterHost = o.ClusterAPIURL
+	}
+	if o.ClusterCA, err = restConfigCA(config); err != nil {
+		return err
+	}
+	if o.ClusterCAFile != "" {
+		ca, err := ioutil.ReadFile(o.ClusterCAFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to read --cluster-ca-file")
+		}
+		o.ClusterCA = string(ca)
+	}
+	if *o.ConfigFlags.Namespace != "" {
+		o.ServiceAccountNamespace = *o.ConfigFlags.Namespace
+	}
 
-	api, err := clientcmd.LoadFromFile(o.KubeConfig)
+	if o.ScopeFromNamespace && !cmd.Flags().Changed("environment-scope") {
+		namespace, _, err := o.ConfigFlags.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return errors.Wrap(err, "unable to get namespace from kubeconfig")
+		}
+		o.EnvironmentScope = namespace
+	}
+	if o.Environment != "" {
+		if cmd.Flags().Changed("environment-scope") || o.ScopeFromNamespace {
+			return fmt.Errorf("--environment sets the environment scope and can't be combined with --environment-scope or --scope-from-namespace")
+		}
+		o.EnvironmentScope = o.Environment
+	}
+
+	if err := o.completeKubeClientSet(); err != nil {
+		return err
+	}
+
+	if o.CAFromCluster {
+		if o.ClusterCAFile != "" {
+			return fmt.Errorf("--ca-from-cluster and --cluster-ca-file are mutually exclusive")
+		}
+		ca, err := o.clusterCAFromConfigMap()
+		if err != nil {
+			return err
+		}
+		if ca != "" {
+			o.ClusterCA = ca
+		}
+	}
+	o.ClusterCA, err = normalizeCA(o.ClusterCA)
 	if err != nil {
-		return errors.Wrap(err, "error creating clientcmdapi from kubeconfig path")
+		return err
+	}
+	if o.ClusterCA == "" && !o.AllowNoCA {
+		if o.CAFromCluster {
+			return fmt.Errorf("no cluster CA found in kubeconfig or the kube-root-ca.crt configmap, pass --allow-no-ca to register the cluster without one")
+		}
+		return fmt.Errorf("no cluster CA found in kubeconfig, pass --allow-no-ca or --ca-from-cluster")
+	}
+
+	return nil
+}
+
+// completeGitLabAuth sets the GitLab token and URL from the flags, stdin and the environment
+func (o *GitLabBootstrapOptions) completeGitLabAuth(cmd *cobra.Command) error {
+	// Precedence: --gitlab-api-token-stdin or --gitlab-api-token, then env["GITLAB_API_TOKEN"]
+	if o.TokenFromStdin {
+		if cmd.Flags().Changed("gitlab-api-token") {
+			return fmt.Errorf("--gitlab-api-token and --gitlab-api-token-stdin are mutually exclusive")
+		}
+		token, err := ioutil.ReadAll(o.In)
+		if err != nil {
+			return errors.Wrap(err, "unable to read GitLab API token from stdin")
+		}
+		o.GitLabAPIToken = strings.TrimSpace(string(token))
+		if o.GitLabAPIToken == "" {
+			return fmt.Errorf("no GitLab API token on stdin")
+		}
+	}
+	if o.GitLabAPIToken == "" {
+		o.GitLabAPIToken = os.Getenv("GITLAB_API_TOKEN")
+	}
+	if o.GitLabURL == "" {
+		o.GitLabURL = os.Getenv("GITLAB_URL")
+	}
+	if o.GitLabURL == "" {
+		// Set in GitLab CI jobs
+		o.GitLabURL = os.Getenv("CI_SERVER_URL")
+	}
+	o.GitLabURL = normalizeGitLabURL(o.GitLabURL)
+
+	// Tokens pasted from the UI or read from files often carry a trailing newline
+	o.GitLabAPIToken = strings.TrimSpace(o.GitLabAPIToken)
+	return nil
+}
+
+// completeClusterName picks the kubeconfig cluster to register from --cluster or the current context
+func (o *GitLabBootstrapOptions) completeClusterName(api *clientcmdapi.Config) error {
+	if name := *o.ConfigFlags.ClusterName; name != "" {
+		if _, ok := api.Clusters[name]; !ok {
+			return fmt.Errorf("cluster %q not found in kubeconfig, check kubectl config get-clusters", name)
+		}
+		o.ClusterName = name
+		return nil
 	}
-	o.KubeAPI = api
 
 	if len(api.Contexts) < 1 {
 		return fmt.Errorf("no contexts found in kubeconfig")
 	}
-	if api.CurrentContext == "" {
+	currentContext := api.CurrentContext
+	if *o.ConfigFlags.Context != "" {
+		currentContext = *o.ConfigFlags.Context
+	}
+	if currentContext == "" {
 		return fmt.Errorf("no context currently set")
 	}
-	o.ClusterName = api.Contexts[api.CurrentContext].Cluster
+	kubeContext, ok := api.Contexts[currentContext]
+	if !ok {
+		return fmt.Errorf("current context %q not found in kubeconfig, check kubectl config get-contexts", currentContext)
+	}
+	if kubeContext.Cluster == "" {
+		return fmt.Errorf("current context %q has no cluster set, check kubectl config get-contexts", currentContext)
+	}
+	if _, ok := api.Clusters[kubeContext.Cluster]; !ok {
+		return fmt.Errorf("cluster %q referenced by context %q not found in kubeconfig, check kubectl config get-contexts", kubeContext.Cluster, currentContext)
+	}
+	o.ClusterName = kubeContext.Cluster
+	return nil
+}
+
+// detectInCluster reports whether the plugin runs in a pod without a kubeconfig
+func (o *GitLabBootstrapOptions) detectInCluster(loader clientcmd.ClientConfig) bool {
+	if *o.ConfigFlags.KubeConfig != "" {
+		return false
+	}
+	for _, file := range loader.ConfigAccess().GetLoadingPrecedence() {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	_, err := restclient.InClusterConfig()
+	return err == nil
+}
+
+// completeInCluster builds the config from the pod's ServiceAccount. There is no context to
+// name the cluster after so --cluster is required.
+func (o *GitLabBootstrapOptions) completeInCluster() (*restclient.Config, error) {
+	config, err := restclient.InClusterConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load in-cluster config")
+	}
+	o.ClusterName = *o.ConfigFlags.ClusterName
+	if o.ClusterName == "" {
+		return nil, fmt.Errorf("--cluster is required to name the cluster when running in-cluster")
+	}
+	// The kubeconfig loader applies --request-timeout, the in-cluster config has to do it by hand
+	timeout, err := parseRequestTimeout(*o.ConfigFlags.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = timeout
+	return config, nil
+}
+
+// parseRequestTimeout parses --request-timeout like kubectl, where a bare number is in seconds
+func parseRequestTimeout(timeout string) (time.Duration, error) {
+	if timeout == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(timeout); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --request-timeout %q, expected a duration like 30s", timeout)
+	}
+	return duration, nil
+}
+
+// normalizeGitLabURL strips trailing slashes and an API path, and defaults the scheme to https.
+// The result is the root of the GitLab instance, which may live under a subpath.
+func normalizeGitLabURL(gitlabURL string) string {
+	gitlabURL = strings.TrimRight(strings.TrimSpace(gitlabURL), "/")
+	gitlabURL = strings.TrimRight(strings.TrimSuffix(gitlabURL, gitlabAPIPath), "/")
+	if gitlabURL != "" && !strings.Contains(gitlabURL, "://") {
+		gitlabURL = "https://" + gitlabURL
+	}
+	return gitlabURL
+}
+
+// gitlabAPIURL returns the API base URL of the GitLab instance rooted at gitlabURL, like
+// https://host/gitlab/api/v4/ for an instance served under /gitlab
+func gitlabAPIURL(gitlabURL string) string {
+	return normalizeGitLabURL(gitlabURL) + gitlabAPIPath + "/"
+}
+
+// completeGitLabTarget sets the GitLab id and target type from the positional arg or the id flags
+func (o *GitLabBootstrapOptions) completeGitLabTarget(args []string) error {
+	if err := o.resolveTarget(); err != nil {
+		return err
+	}
+	if len(o.ProjectIDFlag) > 0 && o.GroupIDFlag != "" {
+		return fmt.Errorf("--project-id and --group-id are mutually exclusive")
+	}
+	if o.ProjectPath != "" {
+		if len(o.ProjectIDFlag) > 0 || o.GroupIDFlag != "" || len(args) != 0 {
+			return fmt.Errorf("--project-path can't be combined with a GitLab id")
+		}
+		if o.gitlabTargetKind() != TargetProject {
+			return fmt.Errorf("--project-path can't be used with --target %s", o.Target)
+		}
+		// Resolved to the numeric id by Validate once the GitLab client exists
+		o.GitLabProjectIDs = []string{o.ProjectPath}
+		o.GitLabProjectID = o.ProjectPath
+		return nil
+	}
+	flagIDs := o.ProjectIDFlag
+	if o.GroupIDFlag != "" {
+		if o.Target != "" && o.Target != TargetGroup {
+			return fmt.Errorf("--group-id can't be used with --target %s", o.Target)
+		}
+		o.Target = TargetGroup
+		flagIDs = []string{o.GroupIDFlag}
+	} else if len(o.ProjectIDFlag) > 0 && o.gitlabTargetKind() != TargetProject {
+		return fmt.Errorf("--project-id can't be used with --target %s", o.Target)
+	}
+
+	switch {
+	case o.Target == TargetInstance:
+		if len(args) != 0 {
+			return fmt.Errorf("GitLab project id can't be used with --target instance")
+		}
+	case len(flagIDs) > 0:
+		if len(args) != 0 {
+			return fmt.Errorf("positional GitLab id can't be combined with --project-id or --group-id")
+		}
+		o.GitLabProjectIDs = flagIDs
+	case len(args) == 0 && o.gitlabTargetKind() == TargetProject && !o.NoCIProject:
+		// Inside a GitLab CI job default to the job's own project
+		if id := ciProjectID(); id != "" {
+			o.infof("Using GitLab project %s of the CI job\n", id)
+			o.GitLabProjectIDs = []string{id}
+		}
+	default:
+		o.GitLabProjectIDs = args
+	}
+	// A missing id is caught by Validate, commands that don't talk to GitLab don't need one
+	if len(o.GitLabProjectIDs) > 0 {
+		o.GitLabProjectID = o.GitLabProjectIDs[0]
+	}
+	return nil
+}
+
+// ciProjectID returns the project of the GitLab CI job, if running in one
+func ciProjectID() string {
+	if id := os.Getenv("CI_PROJECT_ID"); id != "" {
+		return id
+	}
+	return os.Getenv("CI_PROJECT_PATH")
+}
+
+// restConfigCA returns the CA bundle of config, from its CAData or else its CAFile
+func restConfigCA(config *restclient.Config) (string, error) {
+	if len(config.TLSClientConfig.CAData) > 0 || config.TLSClientConfig.CAFile == "" {
+		return string(config.TLSClientConfig.CAData), nil
+	}
+	ca, err := ioutil.ReadFile(config.TLSClientConfig.CAFile)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read cluster CA file")
+	}
+	return string(ca), nil
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
+// completeKubeClientSet creates the Kubernetes clientset from the RestConfig
+func (o *GitLabBootstrapOptions) completeKubeClientSet() error {
+	clientset, err := kubernetes.NewForConfig(o.RestConfig)
 	if err != nil {
 		return errors.Wrap(err, "error creating clientset from config")
 	}
 	o.KubeClientSet = clientset
+	return nil
+}
 
+// CheckClusterReachable ensures the Kubernetes API server answers before anything is changed
+func (o *GitLabBootstrapOptions) CheckClusterReachable() error {
+	version, err := o.KubeClientSet.Discovery().ServerVersion()
+	if err != nil {
+		return wrapKubeError(err, fmt.Sprintf("unable to reach Kubernetes cluster at %s", o.ClusterHost))
+	}
+	if o.Verbose {
+		fmt.Fprintf(o.ErrOut, "Connected to Kubernetes %s at %s\n", version.GitVersion, o.ClusterHost)
+	}
 	return nil
 }
 
 // Validate ensures that all configs are valid
 func (o *GitLabBootstrapOptions) Validate() error {
+	if o.ExpectClusterName != "" && o.ExpectClusterName != o.ClusterName {
+		return fmt.Errorf("expected cluster %q but the kubeconfig points at %q, refusing to continue", o.ExpectClusterName, o.ClusterName)
+	}
+	// Kubernetes is the only platform GitLab can add existing clusters for
+	if o.Platform != "" && o.Platform != PlatformKubernetes {
+		return fmt.Errorf("unsupported platform %q, only %s is supported", o.Platform, PlatformKubernetes)
+	}
+	if o.ClusterDomain != "" {
+		if errs := validation.IsDNS1123Subdomain(o.ClusterDomain); len(errs) > 0 {
+			return fmt.Errorf("invalid cluster domain %q: %s", o.ClusterDomain, strings.Join(errs, "; "))
+		}
+	}
+	if err := o.resolveTarget(); err != nil {
+		return err
+	}
+	if err := o.validateAuthorization(); err != nil {
+		return err
+	}
+	if o.ClusterRoleBindingName != "" {
+		if errs := path.IsValidPathSegmentName(o.ClusterRoleBindingName); len(errs) > 0 {
+			return fmt.Errorf("invalid ClusterRoleBinding name %q: %s", o.ClusterRoleBindingName, strings.Join(errs, "; "))
+		}
+	}
+	if o.SkipRegister {
+		if o.EmitPayload != "" || o.Replace {
+			return fmt.Errorf("--skip-register can't be combined with --emit-payload or --replace")
+		}
+		// Nothing is sent to GitLab so neither a token nor a target is needed
+		return nil
+	}
+	if err := o.validateClusterURLScheme(); err != nil {
+		return err
+	}
+	if o.EmitPayload != "" {
+		// Nothing is sent to GitLab so neither a token nor a target is needed
+		return nil
+	}
+	if o.FakeGitLab {
+		o.startFakeGitLab()
+	}
+	// Runs after the fake GitLab took over GitLabURL, as only a real gitlab.com needs a public cluster
+	if err := o.validateClusterURLReachable(); err != nil {
+		return err
+	}
 	if o.GitLabAPIToken == "" {
 		return fmt.Errorf("GitLab API token is required")
 	}
-	if o.GitLabProjectID == "" {
+	if strings.IndexFunc(o.GitLabAPIToken, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("GitLab API token contains whitespace, check it was copied correctly")
+	}
+	if o.GitLabProjectID == "" && o.Target != TargetInstance {
 		return fmt.Errorf("GitLab project id is required")
 	}
-	o.GitLabAPI = gitlab.NewClient(nil, o.GitLabAPIToken)
-	_, _, err := o.GitLabAPI.Projects.GetProject(o.GitLabProjectID, nil)
+	if o.Environment != "" && o.gitlabTargetKind() != TargetProject {
+		return fmt.Errorf("--environment only works for project clusters, environments belong to projects")
+	}
+	api, err := o.newGitLabClient("")
 	if err != nil {
-		return errors.Wrap(err, "unable to get GitLab project")
+		return err
+	}
+	o.GitLabAPI = api
+	if o.GitLabSudo != "" {
+		if err := o.checkGitLabAdmin("--gitlab-sudo requires an admin API token"); err != nil {
+			return err
+		}
+		if o.GitLabAPI, err = o.newGitLabClient(o.GitLabSudo); err != nil {
+			return err
+		}
+	}
+
+	if !o.NoPreflight {
+		if err := o.CheckGitLabVersion(); err != nil {
+			return err
+		}
 	}
 
+	if o.ProjectPath != "" {
+		if err := o.resolveProjectPath(); err != nil {
+			return err
+		}
+	}
+	if err := o.checkGitLabTarget(); err != nil {
+		return err
+	}
+	// Without --create-environment a missing environment fails before anything is created
+	if o.Environment != "" && !o.CreateEnvironment && !o.SkipTargetCheck {
+		return o.EnsureGitLabEnvironment()
+	}
 	return nil
 }
 
+// checkGitLabTarget ensures the token can access the GitLab project, group or instance
+func (o *GitLabBootstrapOptions) checkGitLabTarget() error {
+	// Project paths always include their namespace, so a bare path can only be a group
+	_, numErr := strconv.Atoi(o.GitLabProjectID)
+	if o.gitlabTargetKind() == TargetProject && numErr != nil && !strings.Contains(o.GitLabProjectID, "/") {
+		return fmt.Errorf("%q looks like a group path, project paths look like group/project. Pass --target group to use the group", o.GitLabProjectID)
+	}
+	if o.SkipTargetCheck {
+		return nil
+	}
+
+	switch o.Target {
+	case TargetInstance:
+		if o.NoPreflight {
+			return nil
+		}
+		return o.checkGitLabAdmin("GitLab instance clusters require an admin API token")
+	case TargetGroup:
+		_, _, err := o.GitLabAPI.Groups.GetGroup(o.GitLabProjectID, gitlab.WithContext(o.ctx))
+		if err != nil {
+			if gitlabStatusCode(err) == http.StatusNotFound {
+				if _, _, projectErr := o.GitLabAPI.Projects.GetProject(o.GitLabProjectID, nil, gitlab.WithContext(o.ctx)); projectErr == nil {
+					return &Error{Stage: StageGitLab, Err: fmt.Errorf("%s is a GitLab project, not a group. Drop --target group", o.GitLabProjectID)}
+				}
+			}
+			return o.wrapGetTargetError(err)
+		}
+		o.gitlabValidated = true
+	default:
+		_, _, err := o.GitLabAPI.Projects.GetProject(o.GitLabProjectID, nil, gitlab.WithContext(o.ctx))
+		if err != nil {
+			if gitlabStatusCode(err) == http.StatusNotFound {
+				if _, _, groupErr := o.GitLabAPI.Groups.GetGroup(o.GitLabProjectID, gitlab.WithContext(o.ctx)); groupErr == nil {
+					return &Error{Stage: StageGitLab, Err: fmt.Errorf("%s is a GitLab group, not a project. Pass --target group", o.GitLabProjectID)}
+				}
+			}
+			return o.wrapGetTargetError(err)
+		}
+		o.gitlabValidated = true
+	}
+
+	return nil
+}
+
+// newGitLabClient creates the GitLab API client, acting as the sudo user if one is given
+func (o *GitLabBootstrapOptions) newGitLabClient(sudo string) (*gitlab.Client, error) {
+	clientOpts := []gitlab.ClientOptionFunc{
+		gitlab.WithCustomRetry(gitlabCheckRetry),
+		gitlab.WithCustomBackoff(gitlabBackoff),
+		gitlab.WithHTTPClient(newGitLabHTTPClient(o.UserAgent, sudo)),
+	}
+	if o.GitLabURL != "" {
+		clientOpts = append(clientOpts, gitlab.WithBaseURL(gitlabAPIURL(o.GitLabURL)))
+	}
+	api, err := gitlab.NewClient(o.GitLabAPIToken, clientOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create GitLab client")
+	}
+	return api, nil
+}
+
+// checkGitLabAdmin ensures the GitLab API token belongs to an admin, failing with message otherwise
+func (o *GitLabBootstrapOptions) checkGitLabAdmin(message string) error {
+	user, _, err := o.GitLabAPI.Users.CurrentUser(gitlab.WithContext(o.ctx))
+	if err != nil {
+		return wrapGitLabError(err, "unable to get GitLab user")
+	}
+	o.gitlabValidated = true
+	if !user.IsAdmin {
+		return &Error{Stage: StageGitLab, Err: errors.New(message)}
+	}
+	return nil
+}
+
+// wrapGetTargetError explains why the GitLab project or group couldn't be fetched
+func (o *GitLabBootstrapOptions) wrapGetTargetError(err error) error {
+	kind := o.gitlabTargetKind()
+	switch gitlabStatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return wrapGitLabError(err, fmt.Sprintf("unable to get GitLab %s, check your GitLab API token and scopes", kind))
+	case http.StatusNotFound:
+		return wrapGitLabError(err, fmt.Sprintf("%s %s not found or token lacks access", kind, o.GitLabProjectID))
+	default:
+		return wrapGitLabError(err, fmt.Sprintf("unable to get GitLab %s", kind))
+	}
+}
+
 // Run executes the command
 func (o *GitLabBootstrapOptions) Run() error {
-	if err := o.CreateServiceAccount(); err != nil {
+	if err := o.ConfirmGitLabDotCom(); err != nil {
 		return err
 	}
-	if err := o.CreateClusterRoleBinding(); err != nil {
+	if err := o.CheckClusterTLS(); err != nil {
 		return err
 	}
-	if err := o.SaveServiceAccountToken(); err != nil {
-		return err
+
+	var steps []runStep
+	if o.CreateNamespaceIfMissing {
+		steps = append(steps, runStep{"Creating namespace", o.CreateNamespace})
 	}
-	if err := o.AddClusterToProject(); err != nil {
-		return err
+	if !o.SkipServiceAccount {
+		steps = append(steps, runStep{"Creating service account", o.CreateServiceAccount})
+	}
+	if !o.SkipClusterRoleBinding {
+		steps = append(steps, runStep{"Creating cluster role binding", o.CreateClusterRoleBinding})
 	}
+	// Skipping registration leaves the token unused unless it is printed, written or waited on
+	if !o.SkipRegister || o.WaitForBinding || o.PrintToken || o.WriteKubeConfig != "" {
+		steps = append(steps, runStep{"Reading service account token", o.SaveServiceAccountToken})
+	}
+	if o.WaitForBinding {
+		steps = append(steps, runStep{"Waiting for cluster role binding", o.WaitForClusterAdmin})
+	}
+	if o.PrintToken {
+		steps = append(steps, runStep{"Printing service account token", func() error {
+			o.WriteServiceAccountToken()
+			return nil
+		}})
+	}
+	if o.WriteKubeConfig != "" {
+		steps = append(steps, runStep{"Writing kubeconfig", o.WriteServiceAccountKubeConfig})
+	}
+	switch {
+	case o.EmitPayload != "":
+		steps = append(steps, runStep{"Printing GitLab payload", o.PrintPayload})
+	case !o.SkipRegister && len(o.GitLabProjectIDs) > 1:
+		steps = append(steps, runStep{"Adding cluster to GitLab", o.AddClusterToTargets})
+	case !o.SkipRegister:
+		steps = append(steps, runStep{"Adding cluster to GitLab", o.AddClusterToGitLab})
+	}
+	if o.Record && !o.SkipRegister && o.EmitPayload == "" {
+		steps = append(steps, runStep{"Recording event", o.RecordEvent})
+	}
+	return o.runSteps(steps)
+}
+
+// objectMeta returns the ObjectMeta for an object created by the plugin
+func (o *GitLabBootstrapOptions) objectMeta(name string) metav1.ObjectMeta {
+	labels := map[string]string{ManagedByLabel: ManagedByValue}
+	for k, v := range o.Labels {
+		labels[k] = v
+	}
+	meta := metav1.ObjectMeta{Name: name, Labels: labels}
+	if len(o.Annotations) > 0 {
+		meta.Annotations = map[string]string{}
+		for k, v := range o.Annotations {
+			meta.Annotations[k] = v
+		}
+	}
+	return meta
+}
+
+// serviceAccountNamespace returns the namespace of the gitlab-admin ServiceAccount
+func (o *GitLabBootstrapOptions) serviceAccountNamespace() string {
+	if o.ServiceAccountNamespace == "" {
+		return "kube-system"
+	}
+	return o.ServiceAccountNamespace
+}
+
+// CreateNamespace creates the ServiceAccount namespace unless it already exists
+func (o *GitLabBootstrapOptions) CreateNamespace() error {
+	nsSpec := &v1.Namespace{ObjectMeta: o.objectMeta(o.serviceAccountNamespace())}
+	_, err := o.KubeClientSet.CoreV1().Namespaces().Create(nsSpec)
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return wrapKubeError(err, "unable to create namespace")
+	}
+	o.infof("Created namespace %s\n", nsSpec.Name)
 	return nil
 }
 
-// CreateServiceAccount creates the gitlab-admin ServiceAccount
+// CreateServiceAccount server-side applies the gitlab-admin ServiceAccount
 func (o *GitLabBootstrapOptions) CreateServiceAccount() error {
-	sai := o.KubeClientSet.CoreV1().ServiceAccounts("kube-system")
-	saSpec := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "gitlab-admin"}}
-	_, err := sai.Create(saSpec)
-	if err != nil {
-		return errors.Wrap(err, "unable to create service account")
+	saSpec := &v1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: o.objectMeta("gitlab-admin"),
+	}
+	namespace := o.serviceAccountNamespace()
+	_, err := o.KubeClientSet.CoreV1().ServiceAccounts(namespace).Get(saSpec.Name, metav1.GetOptions{})
+	if err == nil {
+		o.infof("Using existing ServiceAccount %s/gitlab-admin\n", namespace)
+	} else if !apierrors.IsNotFound(err) {
+		return wrapKubeError(err, "unable to get service account")
+	}
+	if err := o.apply(o.KubeClientSet.CoreV1().RESTClient(), namespace, "serviceaccounts", saSpec.Name, saSpec, &v1.ServiceAccount{}); err != nil {
+		return wrapKubeError(err, "unable to apply service account")
 	}
 	return nil
 }
 
-// CreateClusterRoleBinding creates the gitlab-admin ClusterRoleBinding
-func (o *GitLabBootstrapOptions) CreateClusterRoleBinding() error {
+// clusterRoleBindingName returns the name of the ClusterRoleBinding, gitlab-admin like the
+// ServiceAccount by default
+func (o *GitLabBootstrapOptions) clusterRoleBindingName() string {
+	if o.ClusterRoleBindingName == "" {
+		return "gitlab-admin"
+	}
+	return o.ClusterRoleBindingName
+}
+
+// clusterRoleBindingSpec returns the ClusterRoleBinding granting cluster-admin to the
+// gitlab-admin ServiceAccount and the extra subjects
+func (o *GitLabBootstrapOptions) clusterRoleBindingSpec() *rbacv1.ClusterRoleBinding {
+	// ServiceAccounts are in the core API group, so their subject has no APIGroup
 	crbSubject := rbacv1.Subject{
 		Kind:      rbacv1.ServiceAccountKind,
+		APIGroup:  "",
 		Name:      "gitlab-admin",
-		Namespace: "kube-system",
+		Namespace: o.serviceAccountNamespace(),
 	}
 	roleRef := rbacv1.RoleRef{
-		Name: "cluster-admin",
-		Kind: "ClusterRole",
+		APIGroup: rbacv1.GroupName,
+		Name:     "cluster-admin",
+		Kind:     "ClusterRole",
 	}
-	crbSpec := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "gitlab-admin"}, Subjects: []rbacv1.Subject{crbSubject}, RoleRef: roleRef}
-	_, err := o.KubeClientSet.RbacV1().ClusterRoleBindings().Create(crbSpec)
-	if err != nil {
-		return errors.Wrap(err, "unable to create clusterrolebinding")
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+		ObjectMeta: o.objectMeta(o.clusterRoleBindingName()),
+		Subjects:   append([]rbacv1.Subject{crbSubject}, o.ExtraSubjects...),
+		RoleRef:    roleRef,
+	}
+}
+
+// CreateClusterRoleBinding creates the gitlab-admin ClusterRoleBinding, or server-side applies it
+// when it exists
+func (o *GitLabBootstrapOptions) CreateClusterRoleBinding() error {
+	crbSpec := o.clusterRoleBindingSpec()
+	crbi := o.KubeClientSet.RbacV1().ClusterRoleBindings()
+	client := o.KubeClientSet.RbacV1().RESTClient()
+	existing, err := crbi.Get(crbSpec.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if err := o.create(client, "", "clusterrolebindings", crbSpec, &rbacv1.ClusterRoleBinding{}); err != nil {
+			return wrapKubeError(err, "unable to create clusterrolebinding")
+		}
+		return nil
+	case err != nil:
+		return wrapKubeError(err, "unable to get clusterrolebinding")
+	case !clusterRoleBindingDrifted(existing, crbSpec):
+		o.infof("Using existing ClusterRoleBinding %s\n", crbSpec.Name)
+	case !o.Force:
+		fmt.Fprintf(o.ErrOut, "WARNING: existing ClusterRoleBinding %s doesn't match the expected roleRef and subjects. Pass --force to recreate it.\n", crbSpec.Name)
+		return nil
+	default:
+		// RoleRef is immutable so the binding has to be recreated
+		if err := crbi.Delete(crbSpec.Name, &metav1.DeleteOptions{}); err != nil {
+			return wrapKubeError(err, "unable to delete clusterrolebinding")
+		}
+		o.infof("Recreating drifted ClusterRoleBinding %s\n", crbSpec.Name)
+		if err := o.create(client, "", "clusterrolebindings", crbSpec, &rbacv1.ClusterRoleBinding{}); err != nil {
+			return wrapKubeError(err, "unable to create clusterrolebinding")
+		}
+		return nil
+	}
+	if err := o.apply(client, "", "clusterrolebindings", crbSpec.Name, crbSpec, &rbacv1.ClusterRoleBinding{}); err != nil {
+		return wrapKubeError(err, "unable to apply clusterrolebinding")
 	}
 	return nil
 }
 
-// SaveServiceAccountToken saves the gitlab-admin ServiceAccount token
+// clusterRoleBindingDrifted reports whether the existing binding grants something other than desired
+func clusterRoleBindingDrifted(existing, desired *rbacv1.ClusterRoleBinding) bool {
+	if existing.RoleRef.APIGroup != desired.RoleRef.APIGroup || existing.RoleRef.Kind != desired.RoleRef.Kind || existing.RoleRef.Name != desired.RoleRef.Name {
+		return true
+	}
+	if len(existing.Subjects) != len(desired.Subjects) {
+		return true
+	}
+	for i, subject := range desired.Subjects {
+		e := existing.Subjects[i]
+		if e.Kind != subject.Kind || e.Name != subject.Name || e.Namespace != subject.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveServiceAccountToken saves the gitlab-admin ServiceAccount token. GitLab connects with this
+// bearer token whatever the kubeconfig authenticates with, client certificates aren't forwarded.
 func (o *GitLabBootstrapOptions) SaveServiceAccountToken() error {
-	sai := o.KubeClientSet.CoreV1().ServiceAccounts("kube-system")
+	if err := o.saveServiceAccountToken(); err != nil {
+		o.warnClientCertAuth()
+		return err
+	}
+	if o.Verbose && usesClientCertAuth(o.RestConfig) {
+		fmt.Fprintf(o.ErrOut, "Registering the gitlab-admin token, the kubeconfig client certificate isn't sent to GitLab\n")
+	}
+	return nil
+}
+
+func (o *GitLabBootstrapOptions) saveServiceAccountToken() error {
+	mode, err := o.resolveTokenMode()
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case TokenModeRequest:
+		return o.RequestServiceAccountToken()
+	case tokenModeCreatedSecret:
+		if err := o.createTokenSecret(); err != nil {
+			return err
+		}
+	}
+
+	// The token controller may not have created or populated the secret yet
+	timeout := o.TokenWaitTimeout
+	if timeout == 0 {
+		timeout = defaultTokenWaitTimeout
+	}
+	interval := o.TokenPollInterval
+	if interval == 0 {
+		interval = defaultTokenPollInterval
+	}
+	deadline := time.Now().Add(timeout)
+	warned := false
+	for {
+		secret, err := o.findTokenSecret()
+		if err != nil {
+			return err
+		}
+		if secret != nil {
+			if err := verifyTokenSecret(secret, "gitlab-admin"); err != nil {
+				return err
+			}
+			if token := string(secret.Data["token"]); token != "" {
+				o.ServiceAccountToken = token
+				return nil
+			}
+			if !warned {
+				fmt.Fprintf(o.ErrOut, "WARNING: token secret %s has no token yet, waiting up to %s for the token controller to populate it\n", secret.Name, timeout)
+				warned = true
+			}
+		}
+		if time.Now().After(deadline) {
+			if secret == nil {
+				return &Error{Stage: StageKube, Err: &TokenSecretNotFoundError{Namespace: o.serviceAccountNamespace(), ServiceAccount: "gitlab-admin", Secret: o.TokenSecret}}
+			}
+			return &Error{Stage: StageKube, Err: fmt.Errorf("timed out after %s waiting for the token in secret %s. The token controller of kube-controller-manager fills it in, check it is running and the secret is annotated with %s=gitlab-admin", timeout, secret.Name, v1.ServiceAccountNameKey)}
+		}
+		time.Sleep(wait.Jitter(interval, tokenPollJitter))
+	}
+}
+
+// findTokenSecret returns the --token-secret or the newest gitlab-admin token secret, or nil if
+// there is none yet
+func (o *GitLabBootstrapOptions) findTokenSecret() (*v1.Secret, error) {
+	si := o.KubeClientSet.CoreV1().Secrets(o.serviceAccountNamespace())
+	if o.TokenSecret != "" {
+		secret, err := si.Get(o.TokenSecret, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, wrapKubeError(err, "unable to get serviceaccount token")
+		}
+		return secret, nil
+	}
+
+	sai := o.KubeClientSet.CoreV1().ServiceAccounts(o.serviceAccountNamespace())
 	sa, err := sai.Get("gitlab-admin", metav1.GetOptions{})
 	if err != nil {
-		return errors.Wrap(err, "unable to get serviceaccount")
+		return nil, wrapKubeError(err, "unable to get serviceaccount")
 	}
-	var tokenName string
-	for _, secret := range sa.Secrets {
-		match, err := regexp.MatchString("^gitlab-admin-token-", secret.Name)
+	// sa.Secrets also lists image pull secrets, e.g. the dockercfg secrets OpenShift adds, so only
+	// token secrets issued for gitlab-admin count. Among those prefer the conventionally named ones,
+	// then the newest as the order of sa.Secrets isn't guaranteed.
+	var secret *v1.Secret
+	for _, ref := range sa.Secrets {
+		s, err := si.Get(ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
 		if err != nil {
-			return errors.Wrap(err, "error matching regexp")
+			return nil, wrapKubeError(err, "unable to get serviceaccount token")
 		}
-		if match {
-			tokenName = secret.Name
-			break
+		if s.Type != v1.SecretTypeServiceAccountToken || s.Annotations[v1.ServiceAccountNameKey] != "gitlab-admin" {
+			continue
 		}
+		if secret == nil || preferTokenSecret(s, secret) {
+			secret = s
+		}
+	}
+	return secret, nil
+}
+
+// preferTokenSecret reports whether candidate is a better pick than current, going by the
+// gitlab-admin-token- name prefix the token controller uses and then by creation time
+func preferTokenSecret(candidate, current *v1.Secret) bool {
+	candidateNamed := strings.HasPrefix(candidate.Name, tokenSecretPrefix)
+	currentNamed := strings.HasPrefix(current.Name, tokenSecretPrefix)
+	if candidateNamed != currentNamed {
+		return candidateNamed
 	}
+	return current.CreationTimestamp.Before(&candidate.CreationTimestamp)
+}
 
-	si := o.KubeClientSet.CoreV1().Secrets("kube-system")
-	secret, err := si.Get(tokenName, metav1.GetOptions{})
+// RequestServiceAccountToken mints a bound gitlab-admin token for TokenAudience, or the API
+// server's audience when it is empty, through the TokenRequest API
+func (o *GitLabBootstrapOptions) RequestServiceAccountToken() error {
+	tr := &authenticationv1.TokenRequest{}
+	if o.TokenAudience != "" {
+		tr.Spec.Audiences = []string{o.TokenAudience}
+	}
+	if o.TokenDuration > 0 {
+		seconds := int64(o.TokenDuration.Seconds())
+		tr.Spec.ExpirationSeconds = &seconds
+	}
+	sai := o.KubeClientSet.CoreV1().ServiceAccounts(o.serviceAccountNamespace())
+	tr, err := sai.CreateToken("gitlab-admin", tr)
 	if err != nil {
-		return errors.Wrap(err, "unable to get serviceaccount token")
+		return wrapKubeError(err, "unable to request serviceaccount token")
 	}
-	token := string(secret.Data["token"])
-	if token == "" {
-		return errors.Wrap(err, "no data in serviceaccount token")
+	// Bound tokens always expire, GitLab loses access to the cluster once this one does
+	fmt.Fprintf(o.ErrOut, "WARNING: the requested token expires at %s, after which GitLab can't reach the cluster. Run rotate before then or pass a longer --token-duration\n", tr.Status.ExpirationTimestamp.UTC().Format(time.RFC3339))
+	o.ServiceAccountToken = tr.Status.Token
+	return nil
+}
+
+// verifyTokenSecret ensures secret is a ServiceAccount token issued for the named ServiceAccount
+func verifyTokenSecret(secret *v1.Secret, serviceAccount string) error {
+	if secret.Type != v1.SecretTypeServiceAccountToken {
+		return &Error{Stage: StageKube, Err: fmt.Errorf("secret %s is of type %s, not %s", secret.Name, secret.Type, v1.SecretTypeServiceAccountToken)}
+	}
+	if name := secret.Annotations[v1.ServiceAccountNameKey]; name != serviceAccount {
+		return &Error{Stage: StageKube, Err: fmt.Errorf("secret %s belongs to serviceaccount %q, not %q", secret.Name, name, serviceAccount)}
 	}
-	o.ServiceAccountToken = token
 	return nil
 }
 
-// AddClusterToProject adds the Kubernetes cluster to the GitLab project
-func (o *GitLabBootstrapOptions) AddClusterToProject() error {
-	clusterOpts := &gitlab.AddClusterOptions{
-		Name:             &o.ClusterName,
-		EnvironmentScope: gitlab.String("*"),
-		PlatformKubernetes: &gitlab.AddPlatformKubernetesOptions{
-			APIURL: &o.ClusterHost,
+// infof writes an informational message to ErrOut unless --quiet is set
+func (o *GitLabBootstrapOptions) infof(format string, a ...interface{}) {
+	if o.Quiet {
+		return
+	}
+	fmt.Fprintf(o.ErrOut, format, a...)
+}
+
+// WriteServiceAccountToken writes the raw gitlab-admin ServiceAccount token to Out
+func (o *GitLabBootstrapOptions) WriteServiceAccountToken() {
+	if !o.Yes {
+		fmt.Fprintln(o.ErrOut, "WARNING: printing the gitlab-admin ServiceAccount token which grants cluster-admin access. Pass --yes to silence this warning.")
+	}
+	fmt.Fprintln(o.Out, o.ServiceAccountToken)
+}
+
+// WriteServiceAccountKubeConfig writes a kubeconfig that authenticates as the gitlab-admin ServiceAccount
+func (o *GitLabBootstrapOptions) WriteServiceAccountKubeConfig() error {
+	config := clientcmdapi.NewConfig()
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = o.ClusterHost
+	cluster.CertificateAuthorityData = []byte(o.ClusterCA)
+	config.Clusters[o.ClusterName] = cluster
+
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.Token = o.ServiceAccountToken
+	config.AuthInfos["gitlab-admin"] = authInfo
+
+	kubeContext := clientcmdapi.NewContext()
+	kubeContext.Cluster = o.ClusterName
+	kubeContext.AuthInfo = "gitlab-admin"
+	config.Contexts[o.ClusterName] = kubeContext
+	config.CurrentContext = o.ClusterName
+
+	if err := clientcmd.WriteToFile(*config, o.WriteKubeConfig); err != nil {
+		return errors.Wrap(err, "unable to write kubeconfig")
+	}
+	return nil
+}
+
+// AddClusterToGitLab adds the Kubernetes cluster to the GitLab project, group or instance
+func (o *GitLabBootstrapOptions) AddClusterToGitLab() error {
+	if err := o.checkBearerToken(); err != nil {
+		return err
+	}
+	if o.Replace {
+		if err := o.ReplaceExistingCluster(); err != nil {
+			return err
+		}
+	}
+
+	// The environment must exist before the cluster scoped to it is added
+	if o.Environment != "" {
+		if err := o.EnsureGitLabEnvironment(); err != nil {
+			return err
+		}
+	}
+
+	// A previous run may have added the cluster without seeing the response, adopt it instead of adding a duplicate
+	existing, err := o.findRegisteredCluster()
+	if err != nil {
+		return err
+	}
+
+	var result Result
+	switch {
+	case existing != nil:
+		// Make sure the adopted cluster uses the token and CA of this run
+		err = o.EditGitLabCluster(existing.ID, o.clusterDomain(), &gitlab.EditPlatformKubernetesOptions{
 			Token:  &o.ServiceAccountToken,
 			CaCert: &o.ClusterCA,
-		},
+		})
+		if err != nil {
+			return wrapGitLabError(err, "unable to update existing cluster")
+		}
+		result = Result{ClusterID: existing.ID, ClusterURL: existing.WebURL}
+	case o.Target == TargetInstance:
+		result, err = o.addClusterToInstance()
+	case o.Target == TargetGroup:
+		result, err = o.addClusterToGroup()
+	default:
+		result, err = o.addClusterToProject()
 	}
-	pc, _, err := o.GitLabAPI.ProjectCluster.AddCluster(o.GitLabProjectID, clusterOpts)
 	if err != nil {
-		return errors.Wrap(err, "unable to add project to cluster")
+		return err
+	}
+	result.APIVersion = ResultAPIVersion
+	result.ClusterName = o.ClusterName
+	result.ServiceAccount = "gitlab-admin"
+	result.Namespace = o.serviceAccountNamespace()
+	o.Result = result
+	if existing != nil {
+		o.infof("Cluster %s is already registered in %s, using it\n", existing.Name, o.gitlabTargetKind())
+	} else {
+		o.infof("Cluster successfully added to %s!\n", o.gitlabTargetKind())
+	}
+	if !o.NoHints && !o.Quiet {
+		o.PrintNextSteps(result.ClusterURL)
 	}
-	gitlabClusterURL := fmt.Sprintf("%s/clusters/%d", pc.Project.WebURL, pc.ID)
-	fmt.Println("Cluster successfully added to project!")
-	fmt.Printf("To finish up visit: %s and install Helm and Runner.\n", gitlabClusterURL)
 	return nil
 }
+
+// environmentScope returns the GitLab environment scope, matching all environments by default
+func (o *GitLabBootstrapOptions) environmentScope() string {
+	if o.EnvironmentScope == "" {
+		return "*"
+	}
+	return o.EnvironmentScope
+}
+
+// gitlabWebURL returns the web URL of the GitLab instance the API client talks to
+func (o *GitLabBootstrapOptions) gitlabWebURL() string {
+	u := *o.GitLabAPI.BaseURL()
+	u.Path = strings.TrimSuffix(u.Path, gitlabAPIPath+"/")
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// addClusterErrorMessage names the cluster, GitLab target and instance an add failed for, to triage
+// failures across several GitLab instances
+func (o *GitLabBootstrapOptions) addClusterErrorMessage() string {
+	if o.Target == TargetInstance {
+		return fmt.Sprintf("unable to add cluster %s to GitLab instance %s", o.ClusterName, o.gitlabWebURL())
+	}
+	return fmt.Sprintf("unable to add cluster %s to %s %s on %s", o.ClusterName, o.gitlabTargetKind(), o.GitLabProjectID, o.gitlabWebURL())
+}
+
+func (o *GitLabBootstrapOptions) addClusterToProject() (Result, error) {
+	clusterOpts := o.addClusterPayload()
+	pc, _, err := o.GitLabAPI.ProjectCluster.AddCluster(o.GitLabProjectID, clusterOpts, gitlab.WithContext(o.ctx))
+	if err != nil {
+		return Result{}, wrapGitLabValidationError(err, o.addClusterErrorMessage())
+	}
+	return Result{ClusterID: pc.ID, ClusterURL: fmt.Sprintf("%s/clusters/%d", pc.Project.WebURL, pc.ID)}, nil
+}
+
+func (o *GitLabBootstrapOptions) addClusterToGroup() (Result, error) {
+	clusterOpts := &gitlab.AddGroupClusterOptions{
+		Name:             &o.ClusterName,
+		Domain:           o.clusterDomain(),
+		EnvironmentScope: gitlab.String(o.environmentScope()),
+		Managed:          gitlab.Bool(!o.Unmanaged),
+		PlatformKubernetes: &gitlab.AddGroupPlatformKubernetesOptions{
+			APIURL:            &o.ClusterHost,
+			Token:             &o.ServiceAccountToken,
+			CaCert:            &o.ClusterCA,
+			AuthorizationType: optionalString(o.AuthorizationType),
+		},
+	}
+	o.overlayOptions(clusterOpts)
+	gc, _, err := o.GitLabAPI.GroupCluster.AddCluster(o.GitLabProjectID, clusterOpts, gitlab.WithContext(o.ctx))
+	if err != nil {
+		return Result{}, wrapGitLabValidationError(err, o.addClusterErrorMessage())
+	}
+	return Result{ClusterID: gc.ID, ClusterURL: fmt.Sprintf("%s/-/clusters/%d", gc.Group.WebURL, gc.ID)}, nil
+}
+
+func (o *GitLabBootstrapOptions) addClusterToInstance() (Result, error) {
+	clusterOpts := o.addClusterPayload()
+	ic, _, err := o.GitLabAPI.InstanceCluster.AddCluster(clusterOpts, gitlab.WithContext(o.ctx))
+	if err != nil {
+		return Result{}, wrapGitLabValidationError(err, o.addClusterErrorMessage())
+	}
+	return Result{ClusterID: ic.ID, ClusterURL: fmt.Sprintf("%s/admin/clusters/%d", o.gitlabWebURL(), ic.ID)}, nil
+}
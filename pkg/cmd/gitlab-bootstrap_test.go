@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGitLabAPITokenWhitespace(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{name: "trailing newline", args: []string{"--gitlab-api-token", "glpat-token\n"}, want: "glpat-token"},
+		{name: "surrounding spaces", args: []string{"--gitlab-api-token", "  glpat-token  "}, want: "glpat-token"},
+		{name: "stdin with newline", args: []string{"--gitlab-api-token-stdin"}, stdin: "glpat-token\n", want: "glpat-token"},
+		{name: "inner space", args: []string{"--gitlab-api-token", "glpat token"}, wantErr: "contains whitespace"},
+		{name: "inner newline", args: []string{"--gitlab-api-token", "glpat\ntoken"}, wantErr: "contains whitespace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			o.In = bytes.NewBufferString(tt.stdin)
+			if err := completeTestCommand(t, o, append([]string{"--kubeconfig", kubeconfig, "123"}, tt.args...)...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" {
+				// Validate rejects the token before calling GitLab
+				err := o.Validate()
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if o.GitLabAPIToken != tt.want {
+				t.Errorf("got token %q, want %q", o.GitLabAPIToken, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterRoleBindingSpec(t *testing.T) {
+	o := newTestOptions()
+	o.ServiceAccountNamespace = "gitlab"
+	o.ClusterRoleBindingName = "gitlab-admin-prod"
+	o.ExtraSubjects = []rbacv1.Subject{{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "sre"}}
+
+	want := &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "gitlab-admin-prod",
+			Labels: map[string]string{ManagedByLabel: ManagedByValue},
+		},
+		Subjects: []rbacv1.Subject{
+			// ServiceAccounts are in the core API group, an APIGroup makes the API server reject the subject
+			{Kind: "ServiceAccount", APIGroup: "", Name: "gitlab-admin", Namespace: "gitlab"},
+			{Kind: "Group", APIGroup: "rbac.authorization.k8s.io", Name: "sre"},
+		},
+		RoleRef: rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "cluster-admin"},
+	}
+	if got := o.clusterRoleBindingSpec(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGitLabURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantURL string
+		wantAPI string
+	}{
+		{"root", "https://gitlab.example.com", "https://gitlab.example.com", "https://gitlab.example.com/api/v4/"},
+		{"root with trailing slash", "https://gitlab.example.com/", "https://gitlab.example.com", "https://gitlab.example.com/api/v4/"},
+		{"root with API path", "https://gitlab.example.com/api/v4/", "https://gitlab.example.com", "https://gitlab.example.com/api/v4/"},
+		{"root without scheme", "gitlab.example.com", "https://gitlab.example.com", "https://gitlab.example.com/api/v4/"},
+		{"http root", "http://gitlab.local:8080", "http://gitlab.local:8080", "http://gitlab.local:8080/api/v4/"},
+		{"subpath", "https://example.com/gitlab", "https://example.com/gitlab", "https://example.com/gitlab/api/v4/"},
+		{"subpath with trailing slash", "https://example.com/gitlab/", "https://example.com/gitlab", "https://example.com/gitlab/api/v4/"},
+		{"subpath with API path", "https://example.com/gitlab/api/v4", "https://example.com/gitlab", "https://example.com/gitlab/api/v4/"},
+		{"subpath without scheme", "example.com/gitlab/", "https://example.com/gitlab", "https://example.com/gitlab/api/v4/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeGitLabURL(tt.url); got != tt.wantURL {
+				t.Errorf("normalizeGitLabURL(%q) = %q, want %q", tt.url, got, tt.wantURL)
+			}
+			if got := gitlabAPIURL(tt.url); got != tt.wantAPI {
+				t.Errorf("gitlabAPIURL(%q) = %q, want %q", tt.url, got, tt.wantAPI)
+			}
+
+			// The client talks to the API URL and links back to the instance root
+			o := newTestOptions()
+			o.GitLabURL = normalizeGitLabURL(tt.url)
+			api, err := o.newGitLabClient("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.GitLabAPI = api
+			if got := api.BaseURL().String(); got != tt.wantAPI {
+				t.Errorf("client base URL = %q, want %q", got, tt.wantAPI)
+			}
+			if got := o.gitlabWebURL(); got != tt.wantURL {
+				t.Errorf("gitlabWebURL() = %q, want %q", got, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestBootstrapExampleParses(t *testing.T) {
+	var examples int
+	for _, line := range strings.Split(bootstrapExample, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "kubectl gitlab-bootstrap") {
+			continue
+		}
+		examples++
+		t.Run(line, func(t *testing.T) {
+			args := strings.Fields(strings.TrimPrefix(line, "kubectl gitlab-bootstrap"))
+			for i, arg := range args {
+				args[i] = strings.NewReplacer("<", "", ">", "").Replace(arg)
+			}
+			cmd := NewCmdGitLabBootstrap(newTestOptions().IOStreams)
+			if err := cmd.ParseFlags(args); err != nil {
+				t.Fatalf("example doesn't parse: %v", err)
+			}
+			if got := cmd.Flags().Args(); len(got) != 1 {
+				t.Errorf("example has positional args %q, want the project only", got)
+			}
+		})
+	}
+	if examples == 0 {
+		t.Fatal("bootstrapExample has no kubectl gitlab-bootstrap lines")
+	}
+}
+
+func TestFindTokenSecret(t *testing.T) {
+	secret := func(name string, secretType v1.SecretType, serviceAccount string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "kube-system",
+				Annotations: map[string]string{v1.ServiceAccountNameKey: serviceAccount},
+			},
+			Type: secretType,
+			Data: map[string][]byte{"token": []byte(name)},
+		}
+	}
+	dockercfg := secret("gitlab-admin-dockercfg-x7k2p", v1.SecretTypeDockercfg, "gitlab-admin")
+	token := secret("gitlab-admin-token-4f9qz", v1.SecretTypeServiceAccountToken, "gitlab-admin")
+	otherToken := secret("default-token-8mxl2", v1.SecretTypeServiceAccountToken, "default")
+
+	tests := []struct {
+		name    string
+		secrets []*v1.Secret
+		want    string
+	}{
+		{name: "dockercfg before token", secrets: []*v1.Secret{dockercfg, token}, want: token.Name},
+		{name: "token before dockercfg", secrets: []*v1.Secret{token, dockercfg}, want: token.Name},
+		{name: "dockercfg only", secrets: []*v1.Secret{dockercfg}},
+		{name: "token of another serviceaccount", secrets: []*v1.Secret{dockercfg, otherToken}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "gitlab-admin", Namespace: "kube-system"}}
+			objects := []runtime.Object{sa}
+			for _, s := range tt.secrets {
+				sa.Secrets = append(sa.Secrets, v1.ObjectReference{Name: s.Name})
+				objects = append(objects, s)
+			}
+			o := newTestOptions()
+			o.KubeClientSet = fake.NewSimpleClientset(objects...)
+
+			got, err := o.findTokenSecret()
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("found secret %s, want none", got.Name)
+			case tt.want != "" && got == nil:
+				t.Errorf("found no secret, want %s", tt.want)
+			case tt.want != "" && got.Name != tt.want:
+				t.Errorf("found secret %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitLabValidatedNeedsAuthenticatedCall(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		switch r.URL.Path {
+		case "/api/v4/user":
+			w.Write([]byte(`{"id": 1, "is_admin": true}`))
+		case "/api/v4/projects/12345":
+			w.Write([]byte(`{"id": 12345}`))
+		default:
+			w.Write([]byte(`{"message": "404 Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		target          string
+		status          int
+		skipTargetCheck bool
+		noPreflight     bool
+		want            bool
+	}{
+		{name: "project", status: http.StatusOK, want: true},
+		{name: "instance", target: TargetInstance, status: http.StatusOK, want: true},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "skip target check", status: http.StatusOK, skipTargetCheck: true},
+		{name: "instance without preflight", target: TargetInstance, status: http.StatusOK, noPreflight: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			o := newTestOptions()
+			o.ctx = context.Background()
+			o.GitLabURL = server.URL
+			o.GitLabAPIToken = "glpat-token"
+			o.GitLabProjectID = "12345"
+			o.Target = tt.target
+			o.SkipTargetCheck = tt.skipTargetCheck
+			o.NoPreflight = tt.noPreflight
+			api, err := o.newGitLabClient("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.GitLabAPI = api
+
+			err = o.checkGitLabTarget()
+			if (err != nil) != (tt.status != http.StatusOK) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if o.gitlabValidated != tt.want {
+				t.Errorf("gitlabValidated is %v, want %v", o.gitlabValidated, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestServiceAccountToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		audience      string
+		wantAudiences []string
+	}{
+		{name: "default audience"},
+		{name: "audience", audience: "https://gitlab.example.com", wantAudiences: []string{"https://gitlab.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiration := metav1.NewTime(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))
+			var got *authenticationv1.TokenRequest
+			clientset := fake.NewSimpleClientset()
+			clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				got = action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenRequest)
+				return true, &authenticationv1.TokenRequest{
+					Status: authenticationv1.TokenRequestStatus{Token: "bound-token", ExpirationTimestamp: expiration},
+				}, nil
+			})
+			o := newTestOptions()
+			o.KubeClientSet = clientset
+			o.TokenAudience = tt.audience
+
+			if err := o.RequestServiceAccountToken(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Spec.Audiences, tt.wantAudiences) {
+				t.Errorf("audiences are %#v, want %#v", got.Spec.Audiences, tt.wantAudiences)
+			}
+			if o.ServiceAccountToken != "bound-token" {
+				t.Errorf("token is %q, want bound-token", o.ServiceAccountToken)
+			}
+			if errOut := o.ErrOut.(*bytes.Buffer).String(); !strings.Contains(errOut, "WARNING: the requested token expires at 2030-01-02T03:04:05Z") {
+				t.Errorf("missing expiry warning in %q", errOut)
+			}
+		})
+	}
+}
+
+func TestRecordEventClusterRoleBindingName(t *testing.T) {
+	sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "gitlab-admin", Namespace: "kube-system"}}
+	clientset := fake.NewSimpleClientset(sa)
+	o := newTestOptions()
+	o.KubeClientSet = clientset
+	o.ClusterName = "prod"
+	o.GitLabProjectID = "12345"
+	o.ClusterRoleBindingName = "gitlab-prod-admin"
+
+	if err := o.RecordEvent(); err != nil {
+		t.Fatal(err)
+	}
+	events, err := clientset.CoreV1().Events("kube-system").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("got %d events, want 1", len(events.Items))
+	}
+	want := "ServiceAccount gitlab-admin and ClusterRoleBinding gitlab-prod-admin set up by"
+	if message := events.Items[0].Message; !strings.HasPrefix(message, want) {
+		t.Errorf("event message %q doesn't start with %q", message, want)
+	}
+}
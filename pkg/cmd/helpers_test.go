@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// newTestOptions returns options writing to buffers, so tests can inspect the output
+func newTestOptions() *GitLabBootstrapOptions {
+	return NewGitLabBootstrapOptions(genericclioptions.IOStreams{In: &bytes.Buffer{}, Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}})
+}
+
+// selfSignedCertPEM returns a PEM encoded self-signed CA certificate, unrelated to any server
+func selfSignedCertPEM(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// certPEM returns the PEM encoded certificate of a TLS test server, which is self-signed
+func certPEM(server *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+// completeTestCommand parses args with the root command's flags into o and runs Complete on
+// them, as the bootstrap command does. The user's config file and CI environment are left out.
+func completeTestCommand(t *testing.T, o *GitLabBootstrapOptions, args ...string) error {
+	cmd := newCmdGitLabBootstrap(o)
+	if err := cmd.ParseFlags(append([]string{"--config", os.DevNull, "--no-ci-project"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return o.Complete(cmd, cmd.Flags().Args())
+}
+
+// writeTempFile writes data to a new temporary file and returns its path along with a func
+// removing it
+func writeTempFile(t *testing.T, data string) (string, func()) {
+	file, err := ioutil.TempFile("", "kubectl-gitlab_bootstrap-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		os.Remove(file.Name())
+		t.Fatal(err)
+	}
+	return file.Name(), func() { os.Remove(file.Name()) }
+}
+
+// testKubeconfig returns a kubeconfig for a cluster at server trusting ca, whose user
+// authenticates with userStanza, the YAML of users[].user indented by four spaces
+func testKubeconfig(server, ca, userStanza string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test-cluster
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: test
+  context:
+    cluster: test-cluster
+    user: test-user
+current-context: test
+users:
+- name: test-user
+  user:
+%s
+`, server, base64.StdEncoding.EncodeToString([]byte(ca)), userStanza)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+)
+
+// GitLab 14.5 deprecated certificate-based clusters in favor of the GitLab agent
+const (
+	agentRecommendedMajor = 14
+	agentRecommendedMinor = 5
+)
+
+// PrintNextSteps prints guidance on finishing the integration for the GitLab version in use
+func (o *GitLabBootstrapOptions) PrintNextSteps(clusterURL string) {
+	if o.NoPreflight {
+		o.infof("To finish up visit: %s\n", clusterURL)
+		return
+	}
+	version, err := o.getGitLabVersion()
+	if err != nil {
+		o.infof("To finish up visit: %s\n", clusterURL)
+		return
+	}
+
+	major, minor, ok := parseGitLabVersion(version.Version)
+	if ok && versionAtLeast(major, minor, agentRecommendedMajor, agentRecommendedMinor) {
+		o.infof("To finish up visit: %s\n", clusterURL)
+		o.infof("GitLab %s recommends the GitLab agent and a cluster management project over certificate-based clusters.\n", version.Version)
+		o.infof("See https://docs.gitlab.com/ee/user/clusters/agent/ to connect the agent.\n")
+		return
+	}
+	o.infof("To finish up visit: %s and install Helm and Runner.\n", clusterURL)
+}
+
+// parseGitLabVersion extracts the major and minor release from a version like 13.12.3-ee
+func parseGitLabVersion(version string) (int, int, bool) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// versionAtLeast reports whether major.minor is the same as or newer than wantMajor.wantMinor
+func versionAtLeast(major, minor, wantMajor, wantMinor int) bool {
+	return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// TestBootstrapIntegration runs the bootstrap command against a real API server, started by
+// envtest from the etcd and kube-apiserver binaries in KUBEBUILDER_ASSETS, and the fake GitLab
+func TestBootstrapIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS isn't set to a directory with the etcd and kube-apiserver binaries")
+	}
+	env := &envtest.Environment{}
+	restConfig, err := env.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Stop()
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// envtest runs no token controller, so the token secret it would create is seeded instead
+	namespace := "gitlab-system"
+	if _, err := clientset.CoreV1().Namespaces().Create(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil {
+		t.Fatal(err)
+	}
+	tokenSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        tokenSecretPrefix + "x7k2p",
+			Namespace:   namespace,
+			Annotations: map[string]string{v1.ServiceAccountNameKey: "gitlab-admin"},
+		},
+		Type: v1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{v1.ServiceAccountTokenKey: []byte("sa-token")},
+	}
+	if _, err := clientset.CoreV1().Secrets(namespace).Create(tokenSecret); err != nil {
+		t.Fatal(err)
+	}
+	sa := &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: "gitlab-admin", Namespace: namespace},
+		Secrets:    []v1.ObjectReference{{Name: tokenSecret.Name}},
+	}
+	if _, err := clientset.CoreV1().ServiceAccounts(namespace).Create(sa); err != nil {
+		t.Fatal(err)
+	}
+
+	fake, server := newFakeGitLab(t.Logf)
+	defer server.Close()
+	// envtest serves plain http without authentication, the CA is only passed on to GitLab
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("http://"+restConfig.Host, "", "    token: unused"))
+	defer cleanup()
+	ca := selfSignedCertPEM(t)
+	caFile, cleanup := writeTempFile(t, ca)
+	defer cleanup()
+	args := []string{"--config", os.DevNull, "--no-ci-project", "--kubeconfig", kubeconfig, "--cluster-ca-file", caFile, "--namespace", namespace,
+		"--gitlab-url", server.URL, "--gitlab-api-token", "glpat-token", "--token-mode", TokenModeSecret,
+		"--allow-insecure-cluster-url", "--no-hints", "-o", "json", "12345"}
+	var result Result
+	// A second run applies the existing objects and adopts the registered cluster
+	for _, run := range []string{"first run", "second run"} {
+		o := newTestOptions()
+		cmd := newCmdGitLabBootstrap(o)
+		cmd.SetOutput(o.ErrOut)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%s: %v\n%s", run, err, o.ErrOut)
+		}
+		if err := json.Unmarshal(o.Out.(*bytes.Buffer).Bytes(), &result); err != nil {
+			t.Fatalf("%s: %v\n%s", run, err, o.Out)
+		}
+	}
+
+	gotSA, err := clientset.CoreV1().ServiceAccounts(namespace).Get("gitlab-admin", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotSA.Labels[ManagedByLabel] != ManagedByValue {
+		t.Errorf("ServiceAccount labels are %v, want %s=%s", gotSA.Labels, ManagedByLabel, ManagedByValue)
+	}
+	if len(gotSA.Secrets) != 1 || gotSA.Secrets[0].Name != tokenSecret.Name {
+		t.Errorf("ServiceAccount secrets are %v, applying it must keep %s", gotSA.Secrets, tokenSecret.Name)
+	}
+
+	crb, err := clientset.RbacV1().ClusterRoleBindings().Get("gitlab-admin", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRoleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "cluster-admin"}
+	if crb.RoleRef != wantRoleRef {
+		t.Errorf("roleRef is %+v, want %+v", crb.RoleRef, wantRoleRef)
+	}
+	wantSubjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "gitlab-admin", Namespace: namespace}}
+	if !reflect.DeepEqual(crb.Subjects, wantSubjects) {
+		t.Errorf("subjects are %+v, want %+v", crb.Subjects, wantSubjects)
+	}
+
+	clusters := fake.clusters["projects/12345"]
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters in GitLab, want 1", len(clusters))
+	}
+	cluster := clusters[0]
+	if cluster.Name != "test-cluster" {
+		t.Errorf("cluster name is %q, want the kubeconfig cluster test-cluster", cluster.Name)
+	}
+	if cluster.PlatformKubernetes.APIURL != "http://"+restConfig.Host {
+		t.Errorf("api_url is %q, want http://%s", cluster.PlatformKubernetes.APIURL, restConfig.Host)
+	}
+	if cluster.PlatformKubernetes.Token != "sa-token" {
+		t.Errorf("token is %q, want the ServiceAccount token", cluster.PlatformKubernetes.Token)
+	}
+	if cluster.PlatformKubernetes.CaCert != ca {
+		t.Errorf("ca_cert is %q, want %q", cluster.PlatformKubernetes.CaCert, ca)
+	}
+
+	wantResult := Result{
+		APIVersion:     ResultAPIVersion,
+		ClusterID:      cluster.ID,
+		ClusterURL:     cluster.Project.WebURL + "/clusters/1",
+		ClusterName:    "test-cluster",
+		ServiceAccount: "gitlab-admin",
+		Namespace:      namespace,
+	}
+	if result != wantResult {
+		t.Errorf("result is %+v, want %+v", result, wantResult)
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestCompleteExecCredentialPlugin(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), `    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: kubectl-oidc_login
+      args:
+      - get-token`))
+	defer cleanup()
+
+	o := newTestOptions()
+	if err := completeTestCommand(t, o, "--kubeconfig", kubeconfig, "123"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exec := o.RestConfig.ExecProvider
+	if exec == nil {
+		t.Fatal("exec credential plugin not loaded, requests would be unauthenticated")
+	}
+	if exec.Command != "kubectl-oidc_login" || len(exec.Args) != 1 || exec.Args[0] != "get-token" {
+		t.Errorf("unexpected exec provider %+v", exec)
+	}
+	if o.ClusterHost != "https://k8s.example.com:6443" || o.ClusterName != "test-cluster" {
+		t.Errorf("unexpected cluster %s at %s", o.ClusterName, o.ClusterHost)
+	}
+}
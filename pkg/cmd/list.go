@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdList creates and returns the list subcommand
+func NewCmdList(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list [project id]",
+		Short: "Lists the clusters registered in a GitLab project or group",
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.requireSingleTarget(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.Validate(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.List(); err != nil {
+				return o.explainRevokedToken(err)
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "Output format. One of: json")
+
+	return cmd
+}
+
+// List prints the clusters registered in the GitLab project or group
+func (o *GitLabBootstrapOptions) List() error {
+	clusters, err := o.ListGitLabClusters()
+	if err != nil {
+		return err
+	}
+
+	switch o.Output {
+	case "json":
+		if clusters == nil {
+			clusters = []GitLabCluster{}
+		}
+		data, err := json.MarshalIndent(clusters, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal clusters")
+		}
+		fmt.Fprintln(o.Out, string(data))
+	case "":
+		w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tENVIRONMENT SCOPE\tAPI URL")
+		for _, cluster := range clusters {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", cluster.ID, cluster.Name, cluster.EnvironmentScope, cluster.APIURL)
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q", o.Output)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// TargetResult is the outcome of adding the cluster to one of several GitLab projects or groups
+type TargetResult struct {
+	ID string `json:"id"`
+	Result
+	Error string `json:"error,omitempty"`
+}
+
+// AddClusterToTargets adds the cluster to every GitLab project or group in GitLabProjectIDs,
+// reusing the token read once. Up to Concurrency targets are added at a time, results keep the
+// order of GitLabProjectIDs. Failures are reported and skipped unless FailFast is set, which
+// leaves targets that weren't started yet out.
+func (o *GitLabBootstrapOptions) AddClusterToTargets() error {
+	kind := o.gitlabTargetKind()
+	concurrency := o.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// Targets added in parallel share Out and ErrOut, write to them one at a time
+	streams := o.IOStreams
+	if concurrency > 1 {
+		var mu sync.Mutex
+		streams.Out = &syncWriter{mu: &mu, w: o.Out}
+		streams.ErrOut = &syncWriter{mu: &mu, w: o.ErrOut}
+	}
+
+	results := make([]*TargetResult, len(o.GitLabProjectIDs))
+	indexes := make(chan int)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+				result := o.addClusterToTarget(o.GitLabProjectIDs[i], streams)
+				results[i] = &result
+				if result.Error != "" && o.FailFast {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+	for i := range o.GitLabProjectIDs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	o.TargetResults = nil
+	var failed []string
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		o.TargetResults = append(o.TargetResults, *result)
+		if result.Error != "" {
+			failed = append(failed, result.ID)
+		}
+	}
+
+	o.infof("Cluster added to %d of %d %ss\n", len(o.TargetResults)-len(failed), len(o.GitLabProjectIDs), kind)
+	if len(failed) > 0 {
+		return &Error{Stage: StageGitLab, Err: fmt.Errorf("failed to add cluster to %d of %d %ss: %s", len(failed), len(o.GitLabProjectIDs), kind, strings.Join(failed, ", "))}
+	}
+	return nil
+}
+
+// addClusterToTarget adds the cluster to the GitLab project or group id, writing to streams. It
+// works on a copy of the options so several targets can be added at once.
+func (o *GitLabBootstrapOptions) addClusterToTarget(id string, streams genericclioptions.IOStreams) TargetResult {
+	target := *o
+	target.GitLabProjectID = id
+	target.IOStreams = streams
+	err := target.checkGitLabTarget()
+	if err == nil {
+		err = target.AddClusterToGitLab()
+	}
+	if err != nil {
+		err = target.explainRevokedToken(err)
+		fmt.Fprintf(target.ErrOut, "ERROR: %s %s: %v\n", o.gitlabTargetKind(), id, err)
+		return TargetResult{ID: id, Result: Result{APIVersion: ResultAPIVersion}, Error: err.Error()}
+	}
+	return TargetResult{ID: id, Result: target.Result}
+}
+
+// syncWriter serializes writes to w through mu, which may be shared with other writers
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// requireSingleTarget rejects multiple GitLab ids for commands that work on one target
+func (o *GitLabBootstrapOptions) requireSingleTarget() error {
+	if len(o.GitLabProjectIDs) > 1 {
+		return fmt.Errorf("only one GitLab id can be given")
+	}
+	return nil
+}
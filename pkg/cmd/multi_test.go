@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// overlapWriter records whether a Write started before the previous one returned
+type overlapWriter struct {
+	mu         sync.Mutex
+	buf        bytes.Buffer
+	writing    int32
+	overlapped int32
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if atomic.AddInt32(&w.writing, 1) > 1 {
+		atomic.StoreInt32(&w.overlapped, 1)
+	}
+	defer atomic.AddInt32(&w.writing, -1)
+	// Leave time for writes of the other targets to overlap
+	time.Sleep(10 * time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestAddClusterToTargetsConcurrently(t *testing.T) {
+	fake, server := newFakeGitLab(t.Logf)
+	defer server.Close()
+
+	o := newTestOptions()
+	errOut := &overlapWriter{}
+	o.ErrOut = errOut
+	o.ctx = context.Background()
+	o.GitLabURL = server.URL
+	o.GitLabAPIToken = "glpat-token"
+	o.GitLabProjectIDs = []string{"1", "2", "3", "4"}
+	o.Concurrency = 4
+	o.ClusterName = "prod"
+	o.ClusterHost = "https://k8s.example.com:6443"
+	o.ServiceAccountToken = "sa-token"
+	api, err := o.newGitLabClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.GitLabAPI = api
+
+	if err := o.AddClusterToTargets(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range o.GitLabProjectIDs {
+		if clusters := fake.clusters["projects/"+id]; len(clusters) != 1 {
+			t.Errorf("got %d clusters in project %s, want 1", len(clusters), id)
+		}
+	}
+	if atomic.LoadInt32(&errOut.overlapped) != 0 {
+		t.Error("targets wrote to ErrOut at the same time")
+	}
+	if got := strings.Count(errOut.buf.String(), "Cluster successfully added to project!\n"); got != 4 {
+		t.Errorf("got %d success messages, want 4:\n%s", got, errOut.buf.String())
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	gitlab "github.com/xanzy/go-gitlab"
+	"sigs.k8s.io/yaml"
+)
+
+// loadOptionsFile reads the --options-file add cluster options, warning about keys GitLab's
+// add cluster API for the target doesn't know as they can't be sent. The options the plugin has
+// flag defaults for are taken from the file unless their flag is set.
+func (o *GitLabBootstrapOptions) loadOptionsFile(flags *pflag.FlagSet) error {
+	data, err := ioutil.ReadFile(o.OptionsFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to read --options-file")
+	}
+	overlay, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse --options-file")
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(overlay, &fields); err != nil {
+		return errors.Wrap(err, "--options-file must be a map of add cluster options")
+	}
+	optionsType, platformType := reflect.TypeOf(gitlab.AddClusterOptions{}), reflect.TypeOf(gitlab.AddPlatformKubernetesOptions{})
+	if o.Target == TargetGroup || o.GitLabUseGroup {
+		optionsType, platformType = reflect.TypeOf(gitlab.AddGroupClusterOptions{}), reflect.TypeOf(gitlab.AddGroupPlatformKubernetesOptions{})
+	}
+	unknown := unknownKeys(fields, optionsType, "")
+	if platform, ok := fields["platform_kubernetes_attributes"].(map[string]interface{}); ok {
+		unknown = append(unknown, unknownKeys(platform, platformType, "platform_kubernetes_attributes.")...)
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		fmt.Fprintf(o.ErrOut, "WARNING: unknown key %q in --options-file is ignored\n", key)
+	}
+
+	if err := json.Unmarshal(overlay, reflect.New(optionsType).Interface()); err != nil {
+		return errors.Wrap(err, "invalid --options-file")
+	}
+	// The options with flag defaults are common to the project, group and instance types
+	var fileOpts gitlab.AddClusterOptions
+	json.Unmarshal(overlay, &fileOpts)
+	if fileOpts.Managed != nil && !flags.Changed("managed") {
+		o.ManagedFlag = *fileOpts.Managed
+	}
+	if fileOpts.EnvironmentScope != nil && !flags.Changed("environment-scope") {
+		o.EnvironmentScope = *fileOpts.EnvironmentScope
+	}
+	if platform := fileOpts.PlatformKubernetes; platform != nil && platform.AuthorizationType != nil && !flags.Changed("authorization-type") {
+		o.AuthorizationType = *platform.AuthorizationType
+	}
+	o.optionsOverlay = overlay
+	return nil
+}
+
+// unknownKeys returns the keys of fields that aren't JSON fields of the struct type t
+func unknownKeys(fields map[string]interface{}, t reflect.Type, prefix string) []string {
+	known := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		known[name] = true
+	}
+	var unknown []string
+	for key := range fields {
+		if !known[key] {
+			unknown = append(unknown, prefix+key)
+		}
+	}
+	return unknown
+}
+
+// overlayOptions fills the fields of the add cluster options opts that the flags left unset with
+// the ones from --options-file
+func (o *GitLabBootstrapOptions) overlayOptions(opts interface{}) {
+	if o.optionsOverlay == nil {
+		return
+	}
+	fileOpts := reflect.New(reflect.TypeOf(opts).Elem())
+	// Already checked to parse by loadOptionsFile
+	json.Unmarshal(o.optionsOverlay, fileOpts.Interface())
+	fillUnset(reflect.ValueOf(opts).Elem(), fileOpts.Elem())
+}
+
+// fillUnset sets the nil pointer fields of the struct dst to those of src, descending into
+// nested option structs set in both
+func fillUnset(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, s := dst.Field(i), src.Field(i)
+		if d.Kind() != reflect.Ptr || s.IsNil() {
+			continue
+		}
+		if d.IsNil() {
+			d.Set(s)
+			continue
+		}
+		if d.Elem().Kind() == reflect.Struct {
+			fillUnset(d.Elem(), s.Elem())
+		}
+	}
+}
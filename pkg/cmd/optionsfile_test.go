@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOptionsFileOverFlagDefaults(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+	optionsFile, cleanup := writeTempFile(t, `managed: false
+environment_scope: production
+platform_kubernetes_attributes:
+  authorization_type: abac
+`)
+	defer cleanup()
+
+	tests := []struct {
+		name                  string
+		args                  []string
+		wantManaged           bool
+		wantEnvironmentScope  string
+		wantAuthorizationType string
+	}{
+		{name: "file over defaults", wantManaged: false, wantEnvironmentScope: "production", wantAuthorizationType: "abac"},
+		{
+			name:                  "flags over file",
+			args:                  []string{"--managed", "--environment-scope", "staging", "--authorization-type", "rbac"},
+			wantManaged:           true,
+			wantEnvironmentScope:  "staging",
+			wantAuthorizationType: "rbac",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			args := append([]string{"12345", "--kubeconfig", kubeconfig, "--options-file", optionsFile}, tt.args...)
+			if err := completeTestCommand(t, o, args...); err != nil {
+				t.Fatal(err)
+			}
+			opts := o.addClusterPayload()
+			if *opts.Managed != tt.wantManaged {
+				t.Errorf("managed is %v, want %v", *opts.Managed, tt.wantManaged)
+			}
+			if *opts.EnvironmentScope != tt.wantEnvironmentScope {
+				t.Errorf("environment_scope is %q, want %q", *opts.EnvironmentScope, tt.wantEnvironmentScope)
+			}
+			if *opts.PlatformKubernetes.AuthorizationType != tt.wantAuthorizationType {
+				t.Errorf("authorization_type is %q, want %q", *opts.PlatformKubernetes.AuthorizationType, tt.wantAuthorizationType)
+			}
+		})
+	}
+}
+
+func TestOptionsFileUnknownKeys(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+	optionsFile, cleanup := writeTempFile(t, `management_project_id: "7"
+cluster_type: gke
+platform_kubernetes_attributes:
+  namespace: gitlab
+  insecure: true
+`)
+	defer cleanup()
+	wantWarning := []string{`unknown key "cluster_type"`, `unknown key "platform_kubernetes_attributes.insecure"`}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "project", args: []string{"my-group/my-project"}},
+		{name: "group", args: []string{"my-group", "--target", "group"}},
+		{name: "legacy group", args: []string{"my-group", "--gitlab-use-group"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			args := append([]string{"--kubeconfig", kubeconfig, "--options-file", optionsFile}, tt.args...)
+			if err := completeTestCommand(t, o, args...); err != nil {
+				t.Fatal(err)
+			}
+			errOut := o.ErrOut.(*bytes.Buffer).String()
+			if got := strings.Count(errOut, "WARNING"); got != len(wantWarning) {
+				t.Errorf("got %d warnings %q, want %d", got, errOut, len(wantWarning))
+			}
+			for _, want := range wantWarning {
+				if !strings.Contains(errOut, want) {
+					t.Errorf("warnings %q don't contain %q", errOut, want)
+				}
+			}
+		})
+	}
+}
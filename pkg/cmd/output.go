@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	goTemplatePrefix     = "go-template="
+	goTemplateFilePrefix = "go-template-file="
+)
+
+// completeResultOutput checks -o and parses its Go template, if any. With only --output-file
+// the format is inferred from its extension, leaving -o unset so errors and progress stay as is.
+func (o *GitLabBootstrapOptions) completeResultOutput() error {
+	o.outputFormat = o.Output
+	if o.outputFormat == "" && o.OutputFile != "" {
+		o.outputFormat = "json"
+		if ext := filepath.Ext(o.OutputFile); ext == ".yaml" || ext == ".yml" {
+			o.outputFormat = "yaml"
+		}
+	}
+	var text string
+	switch {
+	case o.Output == "" || o.Output == "json" || o.Output == "yaml":
+		return nil
+	case strings.HasPrefix(o.Output, goTemplatePrefix):
+		text = strings.TrimPrefix(o.Output, goTemplatePrefix)
+	case strings.HasPrefix(o.Output, goTemplateFilePrefix):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(o.Output, goTemplateFilePrefix))
+		if err != nil {
+			return errors.Wrap(err, "unable to read go-template-file")
+		}
+		text = string(data)
+	default:
+		return fmt.Errorf("unsupported output format %q, expected json, yaml, go-template=... or go-template-file=...", o.Output)
+	}
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse output template")
+	}
+	o.outputTemplate = tmpl
+	return nil
+}
+
+// printsResult tells whether the result goes to Out or --output-file
+func (o *GitLabBootstrapOptions) printsResult() bool {
+	return o.Output != "" || o.OutputFile != ""
+}
+
+// PrintResult writes the registered cluster to Out, or --output-file, as JSON, YAML or through
+// the -o Go template. Like kubectl, the template sees the JSON field names, e.g. {{.cluster_url}}
+func (o *GitLabBootstrapOptions) PrintResult(result interface{}) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal result")
+	}
+
+	var out bytes.Buffer
+	switch {
+	case o.outputTemplate != nil:
+		var fields interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return errors.Wrap(err, "unable to unmarshal result")
+		}
+		if err := o.outputTemplate.Execute(&out, fields); err != nil {
+			return errors.Wrap(err, "unable to execute output template")
+		}
+	case o.outputFormat == "yaml":
+		data, err = yaml.JSONToYAML(data)
+		if err != nil {
+			return errors.Wrap(err, "unable to convert result to yaml")
+		}
+		out.Write(data)
+	default:
+		out.Write(data)
+		out.WriteString("\n")
+	}
+
+	if o.OutputFile != "" {
+		return writeFileAtomic(o.OutputFile, out.Bytes())
+	}
+	_, err = o.Out.Write(out.Bytes())
+	return err
+}
+
+// writeFileAtomic writes data to path readable only by the user, through a temporary file in the
+// same directory so readers never see a partial file. Missing parent directories are created.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "unable to create output file directory")
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "unable to create output file")
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to set output file permissions")
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to write output file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "unable to write output file")
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errors.Wrap(err, "unable to write output file")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputFileKeepsPlainErrors(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+
+	o := newTestOptions()
+	cmd := newCmdGitLabBootstrap(o)
+	cmd.SetOutput(o.ErrOut)
+	outputFile := filepath.Join(os.TempDir(), "kubectl-gitlab_bootstrap-test-result.yaml")
+	cmd.SetArgs([]string{"--config", os.DevNull, "--no-ci-project", "--kubeconfig", kubeconfig, "--gitlab-api-token", "glpat-token",
+		"--output-file", outputFile, "--emit-payload=xml", "12345"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected --emit-payload xml to fail")
+	}
+
+	if o.Output != "" {
+		t.Errorf("--output-file set -o to %q", o.Output)
+	}
+	if o.outputFormat != "yaml" {
+		t.Errorf("got output file format %q, want yaml from the file extension", o.outputFormat)
+	}
+	errOut := o.ErrOut.(*bytes.Buffer).String()
+	if !strings.HasPrefix(errOut, `Error: unsupported payload format "xml"`) {
+		t.Errorf("expected cobra's plain error, got %q", errOut)
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	gitlab "github.com/xanzy/go-gitlab"
+
+	"sigs.k8s.io/yaml"
+)
+
+// addClusterPayload returns the body the plugin sends to GitLab's add cluster endpoints.
+// Validate ensures the platform is Kubernetes, the only one with platform options.
+func (o *GitLabBootstrapOptions) addClusterPayload() *gitlab.AddClusterOptions {
+	opts := &gitlab.AddClusterOptions{
+		Name:             &o.ClusterName,
+		Domain:           o.clusterDomain(),
+		EnvironmentScope: gitlab.String(o.environmentScope()),
+		Managed:          gitlab.Bool(!o.Unmanaged),
+		PlatformKubernetes: &gitlab.AddPlatformKubernetesOptions{
+			APIURL:            &o.ClusterHost,
+			Token:             &o.ServiceAccountToken,
+			CaCert:            &o.ClusterCA,
+			Namespace:         optionalString(o.ProjectNamespace),
+			AuthorizationType: optionalString(o.AuthorizationType),
+		},
+	}
+	o.overlayOptions(opts)
+	return opts
+}
+
+// optionalString returns a pointer to s, or nil to leave the field unset when it is empty
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// clusterDomain returns the base domain of the cluster or nil to leave it unset
+func (o *GitLabBootstrapOptions) clusterDomain() *string {
+	if o.ClusterDomain == "" {
+		return nil
+	}
+	return &o.ClusterDomain
+}
+
+// PrintPayload writes the add cluster payload to Out instead of sending it to GitLab
+func (o *GitLabBootstrapOptions) PrintPayload() error {
+	var data []byte
+	var err error
+	switch o.EmitPayload {
+	case "json":
+		data, err = json.MarshalIndent(o.addClusterPayload(), "", "  ")
+	case "yaml":
+		data, err = yaml.Marshal(o.addClusterPayload())
+	default:
+		return fmt.Errorf("unsupported payload format %q", o.EmitPayload)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal payload")
+	}
+	fmt.Fprintln(o.Out, string(data))
+	return nil
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestAddClusterPayloadClusterAPIURL(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://k8s.example.com:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+
+	tests := []struct {
+		name          string
+		clusterAPIURL string
+	}{
+		{name: "rancher proxy", clusterAPIURL: "https://rancher.example.com/k8s/clusters/c-abc12"},
+		{name: "port and path", clusterAPIURL: "https://proxy.example.com:8443/kubernetes/prod"},
+		{name: "trailing slash", clusterAPIURL: "https://proxy.example.com/kubernetes/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			if err := completeTestCommand(t, o, "12345", "--kubeconfig", kubeconfig, "--cluster-api-url", tt.clusterAPIURL); err != nil {
+				t.Fatal(err)
+			}
+			if got := *o.addClusterPayload().PlatformKubernetes.APIURL; got != tt.clusterAPIURL {
+				t.Errorf("APIURL is %q, want %q", got, tt.clusterAPIURL)
+			}
+		})
+	}
+}
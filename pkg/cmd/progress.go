@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// runStep is one phase of Run
+type runStep struct {
+	title string
+	run   func() error
+}
+
+// runSteps runs steps in order, printing a numbered indicator for each to ErrOut on interactive runs.
+// With --verbose it also prints how long each step and the whole run took.
+func (o *GitLabBootstrapOptions) runSteps(steps []runStep) error {
+	showProgress := !o.Quiet && o.Output == "" && isTerminal(o.ErrOut)
+	start := time.Now()
+	for i, step := range steps {
+		if showProgress {
+			fmt.Fprintf(o.ErrOut, "[%d/%d] %s...\n", i+1, len(steps), step.title)
+		}
+		stepStart := time.Now()
+		err := step.run()
+		if o.Verbose {
+			fmt.Fprintf(o.ErrOut, "%s took %s\n", step.title, time.Since(stepStart).Round(time.Millisecond))
+		}
+		if err != nil {
+			return err
+		}
+		if showProgress {
+			fmt.Fprintf(o.ErrOut, "[%d/%d] %s ✓\n", i+1, len(steps), step.title)
+		}
+	}
+	if o.Verbose {
+		fmt.Fprintf(o.ErrOut, "Total %s\n", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// isTerminal reports whether stream is an interactive terminal
+func isTerminal(stream interface{}) bool {
+	f, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// resolveProjectPath sets the GitLab project id from --project-path. An exact lookup is tried
+// first, falling back to a search by project name for a path differing only in case when GitLab
+// can't find the path as given.
+func (o *GitLabBootstrapOptions) resolveProjectPath() error {
+	project, _, err := o.GitLabAPI.Projects.GetProject(o.ProjectPath, nil, gitlab.WithContext(o.ctx))
+	if err != nil && gitlabStatusCode(err) != http.StatusNotFound {
+		return wrapGitLabError(err, fmt.Sprintf("unable to get GitLab project %s", o.ProjectPath))
+	}
+	if err != nil {
+		project, err = o.searchProjectPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	id := strconv.Itoa(project.ID)
+	o.infof("Using GitLab project %s (id %s)\n", project.PathWithNamespace, id)
+	o.GitLabProjectID = id
+	o.GitLabProjectIDs = []string{id}
+	return nil
+}
+
+// searchProjectPath searches the projects visible to the token, page by page, for one whose path
+// matches --project-path ignoring case. Projects of the same name elsewhere are only suggested,
+// never picked.
+func (o *GitLabBootstrapOptions) searchProjectPath() (*gitlab.Project, error) {
+	opts := &gitlab.ListProjectsOptions{
+		ListOptions:      gitlab.ListOptions{PerPage: 100},
+		Search:           gitlab.String(path.Base(o.ProjectPath)),
+		SearchNamespaces: gitlab.Bool(true),
+		Simple:           gitlab.Bool(true),
+	}
+	var candidates []*gitlab.Project
+	for {
+		projects, resp, err := o.GitLabAPI.Projects.ListProjects(opts, gitlab.WithContext(o.ctx))
+		if err != nil {
+			return nil, wrapGitLabError(err, fmt.Sprintf("unable to search GitLab projects for %s", o.ProjectPath))
+		}
+		for _, project := range projects {
+			if strings.EqualFold(project.PathWithNamespace, o.ProjectPath) {
+				return project, nil
+			}
+			if strings.HasSuffix(strings.ToLower(project.PathWithNamespace), "/"+strings.ToLower(path.Base(o.ProjectPath))) {
+				candidates = append(candidates, project)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	if len(candidates) == 0 {
+		return nil, &Error{Stage: StageGitLab, Err: fmt.Errorf("project %s not found or token lacks access", o.ProjectPath)}
+	}
+	var paths []string
+	for _, project := range candidates {
+		paths = append(paths, fmt.Sprintf("  %s (id %d)", project.PathWithNamespace, project.ID))
+	}
+	return nil, &Error{Stage: StageGitLab, Err: fmt.Errorf("project %s not found, did you mean one of:\n%s", o.ProjectPath, strings.Join(paths, "\n"))}
+}
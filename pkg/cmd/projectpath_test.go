@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResolveProjectPath(t *testing.T) {
+	var projects []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/v4/projects" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "404 Project Not Found"}`))
+			return
+		}
+		if perPage := r.URL.Query().Get("per_page"); perPage != "100" {
+			t.Errorf("got per_page %q, want 100", perPage)
+		}
+		// Serve two projects a page to make the search go through the pages
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		start, end := (page-1)*2, page*2
+		if end < len(projects) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			end = len(projects)
+		}
+		if start > end {
+			start = end
+		}
+		json.NewEncoder(w).Encode(projects[start:end])
+	}))
+	defer server.Close()
+
+	project := func(id int, path string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "path_with_namespace": path}
+	}
+	tests := []struct {
+		name     string
+		projects []map[string]interface{}
+		wantID   string
+		wantErr  string
+	}{
+		{name: "differing case", projects: []map[string]interface{}{project(7, "other/App"), project(8, "My-Group/App")}, wantID: "8"},
+		{name: "match on a later page", projects: []map[string]interface{}{project(7, "other/app"), project(9, "my-group/sub/app"), project(8, "my-group/APP")}, wantID: "8"},
+		{name: "single candidate", projects: []map[string]interface{}{project(7, "other/app")}, wantErr: "project my-group/app not found, did you mean one of:\n  other/app (id 7)"},
+		{name: "several candidates", projects: []map[string]interface{}{project(7, "other/app"), project(9, "my-group/sub/app")}, wantErr: "  other/app (id 7)\n  my-group/sub/app (id 9)"},
+		{name: "none", wantErr: "project my-group/app not found or token lacks access"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projects = tt.projects
+			o := newTestOptions()
+			o.ctx = context.Background()
+			o.GitLabURL = server.URL
+			o.GitLabAPIToken = "glpat-token"
+			o.ProjectPath = "my-group/app"
+			api, err := o.newGitLabClient("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.GitLabAPI = api
+
+			err = o.resolveProjectPath()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v doesn't contain %q", err, tt.wantErr)
+				}
+				if o.GitLabProjectID != "" {
+					t.Errorf("project id %s was picked", o.GitLabProjectID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.GitLabProjectID != tt.wantID {
+				t.Errorf("project id is %s, want %s", o.GitLabProjectID, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// maxRateLimitWait bounds how long a rate limited GitLab request is retried for
+const maxRateLimitWait = 60 * time.Second
+
+// gitlabCheckRetry retries rate limited and failed GitLab requests unless GitLab asks for a longer wait than maxRateLimitWait
+func gitlabCheckRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait, ok := retryAfter(resp)
+		return !ok || wait <= maxRateLimitWait, nil
+	}
+	return resp.StatusCode >= 500, nil
+}
+
+// gitlabBackoff waits for the Retry-After duration on rate limited GitLab requests
+func gitlabBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := retryAfter(resp); ok {
+			return wait
+		}
+	}
+	return retryablehttp.LinearJitterBackoff(min, max, attemptNum, resp)
+}
+
+// retryAfter parses the Retry-After header in either its seconds or HTTP date form
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// rateLimitMessage describes a rate limited GitLab error or returns "" for any other error
+func rateLimitMessage(err error) string {
+	if gitlabStatusCode(err) != http.StatusTooManyRequests {
+		return ""
+	}
+	if wait, ok := retryAfter(gitlabResponse(err)); ok {
+		return fmt.Sprintf("rate limited by GitLab, retry after %d seconds", int(wait.Seconds()))
+	}
+	return "rate limited by GitLab"
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ReplaceExistingCluster deletes a GitLab cluster with the same name so it can be added fresh.
+// Nothing is deleted unless the new registration looks valid and the user confirmed.
+func (o *GitLabBootstrapOptions) ReplaceExistingCluster() error {
+	if err := o.validateAddClusterPayload(); err != nil {
+		return &Error{Stage: StageValidate, Err: err}
+	}
+
+	clusters, err := o.ListGitLabClusters()
+	if err != nil {
+		return err
+	}
+	var existing *GitLabCluster
+	for i := range clusters {
+		if clusters[i].Name == o.ClusterName {
+			existing = &clusters[i]
+			break
+		}
+	}
+	if existing == nil {
+		return nil
+	}
+
+	if !o.Yes && !o.confirm(fmt.Sprintf("Delete cluster %s (id %d) from GitLab %s and add it again?", existing.Name, existing.ID, o.gitlabTargetKind())) {
+		return &Error{Stage: StageValidate, Err: fmt.Errorf("replacing cluster %s aborted", existing.Name)}
+	}
+	if err := o.DeleteGitLabCluster(existing.ID); err != nil {
+		return wrapGitLabError(err, "unable to delete existing cluster")
+	}
+	o.infof("Deleted existing cluster %s from GitLab %s\n", existing.Name, o.gitlabTargetKind())
+	return nil
+}
+
+// ConfirmGitLabDotCom warns that cluster-admin credentials are about to be shipped to gitlab.com and
+// asks to continue. Non-interactive runs have to pass --yes. Self-managed instances are skipped.
+func (o *GitLabBootstrapOptions) ConfirmGitLabDotCom() error {
+	if !isGitLabDotCom(o.GitLabURL) || o.EmitPayload != "" || o.SkipRegister || o.Yes {
+		return nil
+	}
+	fmt.Fprintln(o.ErrOut, "WARNING: this grants cluster-admin to the gitlab-admin ServiceAccount and sends its token to gitlab.com.")
+	fmt.Fprintln(o.ErrOut, "WARNING: anyone with maintainer access to the GitLab target can then administer the cluster.")
+	if !isTerminal(o.In) {
+		return &Error{Stage: StageValidate, Err: fmt.Errorf("refusing to send a cluster-admin token to gitlab.com non-interactively, pass --yes to continue")}
+	}
+	if !o.confirm("Continue?") {
+		return &Error{Stage: StageValidate, Err: fmt.Errorf("aborted")}
+	}
+	return nil
+}
+
+// isGitLabDotCom reports whether gitlabURL, empty meaning the default, points at gitlab.com
+func isGitLabDotCom(gitlabURL string) bool {
+	if gitlabURL == "" {
+		return true
+	}
+	u, err := url.Parse(gitlabURL)
+	return err == nil && u.Hostname() == "gitlab.com"
+}
+
+// validateAddClusterPayload catches registrations GitLab would reject before anything is deleted
+func (o *GitLabBootstrapOptions) validateAddClusterPayload() error {
+	if o.ClusterName == "" {
+		return fmt.Errorf("cluster name is required")
+	}
+	if u, err := url.Parse(o.ClusterHost); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid cluster API URL %q", o.ClusterHost)
+	}
+	if o.ServiceAccountToken == "" {
+		return fmt.Errorf("service account token is empty")
+	}
+	return nil
+}
+
+// confirm asks question on ErrOut and reports whether the answer read from In was yes
+func (o *GitLabBootstrapOptions) confirm(question string) bool {
+	fmt.Fprintf(o.ErrOut, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(o.In).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// NewCmdRotate creates and returns the rotate subcommand
+func NewCmdRotate(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate [project id]",
+		Short: "Pushes the current ServiceAccount token to an already bootstrapped GitLab cluster",
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.requireSingleTarget(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.CheckClusterReachable(); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.Rotate(); err != nil {
+				return o.explainRevokedToken(err)
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().IntVar(&o.GitLabClusterID, "cluster-id", 0, "Id of the GitLab cluster to update, whatever its name. Needed when several clusters share the kubeconfig cluster name")
+	o.addErrorOutputFlag(cmd)
+
+	return cmd
+}
+
+// Rotate re-reads the ServiceAccount token and updates the existing GitLab cluster with it
+func (o *GitLabBootstrapOptions) Rotate() error {
+	if err := o.SaveServiceAccountToken(); err != nil {
+		return err
+	}
+	if err := o.UpdateClusterToken(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateClusterToken updates the token, and the CA if it changed, of the existing GitLab cluster
+func (o *GitLabBootstrapOptions) UpdateClusterToken() error {
+	cluster, err := o.FindGitLabCluster()
+	if err != nil {
+		return err
+	}
+
+	var caCert *string
+	if cluster.CaCert != o.ClusterCA {
+		caCert = &o.ClusterCA
+	}
+
+	err = o.EditGitLabCluster(cluster.ID, nil, &gitlab.EditPlatformKubernetesOptions{
+		Token:  &o.ServiceAccountToken,
+		CaCert: caCert,
+	})
+	if err != nil {
+		return wrapGitLabError(err, "unable to update cluster token")
+	}
+	o.infof("Token for cluster %s successfully rotated!\n", o.ClusterName)
+	return nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// Kinds of GitLab cluster the plugin can add
+const (
+	// TargetProject adds a project cluster, the default
+	TargetProject = "project"
+	// TargetGroup adds a group cluster shared by the projects of the group
+	TargetGroup = "group"
+	// TargetInstance adds an instance cluster shared by every project. Requires an admin token
+	TargetInstance = "instance"
+)
+
+// resolveTarget folds the deprecated GitLabUseGroup and GitLabInstance into Target and checks
+// Target is a known kind. An empty Target means TargetProject.
+func (c *Config) resolveTarget() error {
+	if c.GitLabUseGroup && c.GitLabInstance {
+		return fmt.Errorf("--gitlab-use-group and --gitlab-instance are mutually exclusive")
+	}
+	var legacy string
+	switch {
+	case c.GitLabInstance:
+		legacy = TargetInstance
+	case c.GitLabUseGroup:
+		legacy = TargetGroup
+	}
+	if legacy != "" {
+		if c.Target != "" && c.Target != legacy {
+			return fmt.Errorf("--target %s conflicts with the %s target implied by --gitlab-use-group or --gitlab-instance", c.Target, legacy)
+		}
+		c.Target = legacy
+	}
+
+	switch c.Target {
+	case "", TargetProject, TargetGroup, TargetInstance:
+		return nil
+	default:
+		return fmt.Errorf("unsupported target %q, must be one of %s, %s or %s", c.Target, TargetProject, TargetGroup, TargetInstance)
+	}
+}
+
+// gitlabTargetKind names the kind of GitLab cluster being added
+func (o *GitLabBootstrapOptions) gitlabTargetKind() string {
+	if o.Target == "" {
+		return TargetProject
+	}
+	return o.Target
+}
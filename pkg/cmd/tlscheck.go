@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tlsCheckTimeout bounds the TLS handshake with the cluster API server
+const tlsCheckTimeout = 10 * time.Second
+
+// validateClusterURLScheme ensures ClusterHost is an https URL, as GitLab only connects to
+// clusters over TLS, unless AllowInsecureClusterURL is set
+func (o *GitLabBootstrapOptions) validateClusterURLScheme() error {
+	host, err := url.Parse(o.ClusterHost)
+	if err != nil || host.Scheme == "https" || o.AllowInsecureClusterURL {
+		return nil
+	}
+	source := "the kubeconfig"
+	if o.ClusterAPIURL != "" {
+		source = "--cluster-api-url"
+	}
+	return fmt.Errorf("the cluster API URL %s from %s isn't https, which GitLab requires. Point it at the API server's TLS endpoint, e.g. with --cluster-api-url, or pass --allow-insecure-cluster-url for local testing", o.ClusterHost, source)
+}
+
+// privateNetworks are the IPv4 and IPv6 private address ranges, net.IP has no IsPrivate before Go 1.17
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// isPrivateHost reports whether host is localhost or a loopback, link-local or private IP. Other
+// names aren't resolved, they may well resolve differently for GitLab.
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateClusterURLReachable refuses to register a localhost or private ClusterHost, like that
+// of kubectl proxy or a kind cluster, on gitlab.com as it can never connect. Self-managed
+// instances may sit on the same network so they are let through.
+func (o *GitLabBootstrapOptions) validateClusterURLReachable() error {
+	if !isGitLabDotCom(o.GitLabURL) || o.AllowPrivateClusterURL {
+		return nil
+	}
+	host, err := url.Parse(o.ClusterHost)
+	if err != nil || !isPrivateHost(host.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("the cluster API URL %s is a localhost or private network address gitlab.com can't reach. Pass --cluster-api-url with an address reachable from the internet, or --allow-private-cluster-url to register it anyway", o.ClusterHost)
+}
+
+// CheckClusterTLS dials ClusterHost the way GitLab will, trusting only ClusterCA, and reports a
+// certificate that doesn't validate for the host. It warns unless StrictTLS is set. Nothing is
+// checked with --no-preflight, or when the cluster isn't registered with --skip-register or
+// --emit-payload, as the API server may then not be reachable from where the plugin runs.
+func (o *GitLabBootstrapOptions) CheckClusterTLS() error {
+	if o.ClusterCA == "" || o.NoPreflight || o.SkipRegister || o.EmitPayload != "" {
+		return nil
+	}
+	host, err := url.Parse(o.ClusterHost)
+	if err != nil || host.Scheme != "https" {
+		return nil
+	}
+	address := host.Host
+	if host.Port() == "" {
+		address = net.JoinHostPort(host.Hostname(), "443")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(o.ClusterCA))
+	dialer := &net.Dialer{Timeout: tlsCheckTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		RootCAs:    roots,
+		ServerName: host.Hostname(),
+	})
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+
+	// Verification failures come wrapped in a *tls.CertificateVerificationError since Go 1.20
+	var message string
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	switch {
+	case errors.As(err, &hostnameErr):
+		names := append(append([]string{}, hostnameErr.Certificate.DNSNames...), ipStrings(hostnameErr.Certificate.IPAddresses)...)
+		message = fmt.Sprintf("the API server certificate isn't valid for %s, only for %s. GitLab won't be able to connect, pass --cluster-api-url with one of those names", host.Hostname(), strings.Join(names, ", "))
+	case errors.As(err, &authorityErr):
+		message = fmt.Sprintf("the API server certificate at %s isn't signed by the cluster CA. GitLab won't be able to connect, check --cluster-ca-file", o.ClusterHost)
+	default:
+		message = fmt.Sprintf("unable to verify the TLS certificate of %s: %v", o.ClusterHost, err)
+	}
+	if o.StrictTLS {
+		return &Error{Stage: StageValidate, Err: errors.New(message)}
+	}
+	fmt.Fprintf(o.ErrOut, "WARNING: %s\n", message)
+	return nil
+}
+
+func ipStrings(ips []net.IP) []string {
+	var names []string
+	for _, ip := range ips {
+		names = append(names, ip.String())
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckClusterTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	// Failed handshakes are expected, keep them out of the test output
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The httptest certificate is valid for 127.0.0.1 and example.com, not localhost
+	localhostURL := "https://localhost:" + serverURL.Port()
+
+	tests := []struct {
+		name         string
+		host         string
+		ca           string
+		skipRegister bool
+		emitPayload  string
+		wantErr      string
+	}{
+		{name: "valid", host: server.URL, ca: certPEM(server)},
+		{name: "hostname mismatch", host: localhostURL, ca: certPEM(server), wantErr: "isn't valid for localhost, only for example.com, *.example.com, 127.0.0.1, ::1. GitLab won't be able to connect, pass --cluster-api-url"},
+		{name: "unknown authority", host: server.URL, ca: selfSignedCertPEM(t), wantErr: "isn't signed by the cluster CA"},
+		{name: "skip register", host: server.URL, ca: selfSignedCertPEM(t), skipRegister: true},
+		{name: "emit payload", host: server.URL, ca: selfSignedCertPEM(t), emitPayload: "json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			o.ClusterHost = tt.host
+			o.ClusterCA = tt.ca
+			o.StrictTLS = true
+			o.SkipRegister = tt.skipRegister
+			o.EmitPayload = tt.emitPayload
+			err := o.CheckClusterTLS()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateClusterURLReachable(t *testing.T) {
+	kubeconfig, cleanup := writeTempFile(t, testKubeconfig("https://127.0.0.1:6443", selfSignedCertPEM(t), "    token: kube-token"))
+	defer cleanup()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "gitlab.com", args: []string{"--gitlab-api-token", "glpat-token"}, wantErr: "is a localhost or private network address gitlab.com can't reach"},
+		{name: "fake gitlab", args: []string{"--fake-gitlab"}},
+		{name: "emit payload", args: []string{"--emit-payload", "json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOptions()
+			if err := completeTestCommand(t, o, append([]string{"12345", "--kubeconfig", kubeconfig}, tt.args...)...); err != nil {
+				t.Fatal(err)
+			}
+			err := o.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v doesn't contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Ways of getting the gitlab-admin ServiceAccount token
+const (
+	// TokenModeAuto picks TokenModeSecret, or a created token secret from Kubernetes 1.24 on
+	TokenModeAuto = "auto"
+	// TokenModeSecret reads the token secret the token controller creates for the ServiceAccount
+	TokenModeSecret = "secret"
+	// TokenModeRequest mints a bound token through the TokenRequest API
+	TokenModeRequest = "request"
+
+	// tokenModeCreatedSecret creates a token secret for the token controller to fill in
+	tokenModeCreatedSecret = "created-secret"
+)
+
+// Kubernetes 1.24 stopped creating token secrets for ServiceAccounts
+var noAutoTokenSecretVersion = version.MustParseGeneric("1.24")
+
+// resolveTokenMode returns how to get the ServiceAccount token, asking the API server for its
+// version in auto mode. A --token-audience always means a TokenRequest.
+func (o *GitLabBootstrapOptions) resolveTokenMode() (string, error) {
+	switch o.TokenMode {
+	case "", TokenModeAuto:
+	case TokenModeSecret:
+		if o.TokenAudience != "" {
+			return "", &Error{Stage: StageValidate, Err: fmt.Errorf("--token-audience needs --token-mode %s", TokenModeRequest)}
+		}
+		return TokenModeSecret, nil
+	case TokenModeRequest:
+		return TokenModeRequest, nil
+	default:
+		return "", &Error{Stage: StageValidate, Err: fmt.Errorf("unsupported token mode %q, must be one of %s, %s or %s", o.TokenMode, TokenModeAuto, TokenModeSecret, TokenModeRequest)}
+	}
+
+	if o.TokenAudience != "" {
+		return TokenModeRequest, nil
+	}
+	serverVersion, err := o.KubeClientSet.Discovery().ServerVersion()
+	if err != nil {
+		return "", wrapKubeError(err, "unable to get Kubernetes version to pick the token mode")
+	}
+	parsed, err := version.ParseGeneric(serverVersion.GitVersion)
+	if err != nil {
+		return "", &Error{Stage: StageKube, Err: fmt.Errorf("unable to parse Kubernetes version %q, pass --token-mode", serverVersion.GitVersion)}
+	}
+	if parsed.AtLeast(noAutoTokenSecretVersion) {
+		return tokenModeCreatedSecret, nil
+	}
+	return TokenModeSecret, nil
+}
+
+// createTokenSecret creates the --token-secret, or gitlab-admin-token, for the token controller to
+// fill with a long lived gitlab-admin token and reads from it from then on
+func (o *GitLabBootstrapOptions) createTokenSecret() error {
+	if o.TokenSecret == "" {
+		o.TokenSecret = "gitlab-admin-token"
+	}
+	meta := o.objectMeta(o.TokenSecret)
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[v1.ServiceAccountNameKey] = "gitlab-admin"
+	secret := &v1.Secret{ObjectMeta: meta, Type: v1.SecretTypeServiceAccountToken}
+	_, err := o.KubeClientSet.CoreV1().Secrets(o.serviceAccountNamespace()).Create(secret)
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return wrapKubeError(err, fmt.Sprintf("unable to create token secret %s", o.TokenSecret))
+	}
+	o.infof("Created token secret %s\n", o.TokenSecret)
+	return nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// NewCmdUpdateCA creates and returns the update-ca subcommand
+func NewCmdUpdateCA(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update-ca [project id]",
+		Short: "Pushes the current cluster CA to an already bootstrapped GitLab cluster",
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.requireSingleTarget(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.Validate(); err != nil {
+				return classifyError(err, StageValidate)
+			}
+			if err := o.UpdateClusterCA(); err != nil {
+				return o.explainRevokedToken(err)
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().BoolVar(&o.AlsoToken, "also-token", false, "Also push the current ServiceAccount token")
+	cmd.Flags().BoolVar(&o.MergeCA, "merge-ca", false, "Append the current CA to the CA bundle in GitLab instead of replacing it, to trust both during a CA rotation")
+	cmd.Flags().IntVar(&o.GitLabClusterID, "cluster-id", 0, "Id of the GitLab cluster to update, whatever its name. Needed when several clusters share the kubeconfig cluster name")
+	cmd.Flags().BoolVar(&o.AlsoURL, "also-url", false, "Also push the current cluster API URL")
+	o.addErrorOutputFlag(cmd)
+
+	return cmd
+}
+
+// UpdateClusterCA updates the CA, and optionally the token and API URL, of the existing GitLab cluster
+func (o *GitLabBootstrapOptions) UpdateClusterCA() error {
+	cluster, err := o.FindGitLabCluster()
+	if err != nil {
+		return err
+	}
+
+	ca := o.ClusterCA
+	if o.MergeCA {
+		ca, err = mergeCA(cluster.CaCert, o.ClusterCA)
+		if err != nil {
+			return &Error{Stage: StageValidate, Err: errors.Wrap(err, "unable to merge CA with the one in GitLab")}
+		}
+	}
+	platform := &gitlab.EditPlatformKubernetesOptions{
+		CaCert: &ca,
+	}
+	if o.AlsoToken {
+		if err := o.SaveServiceAccountToken(); err != nil {
+			return err
+		}
+		platform.Token = &o.ServiceAccountToken
+	}
+	if o.AlsoURL {
+		platform.APIURL = &o.ClusterHost
+	}
+
+	if err := o.EditGitLabCluster(cluster.ID, nil, platform); err != nil {
+		return wrapGitLabError(err, "unable to update cluster CA")
+	}
+	o.infof("CA for cluster %s successfully updated!\n", o.ClusterName)
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"net/http"
+)
+
+// defaultUserAgent identifies the plugin in the GitLab request logs
+var defaultUserAgent = "kubectl-gitlab_bootstrap/" + Version
+
+// gitlabTransport sets the User-Agent header, and the sudo user if there is one, on every request
+// before handing it to next
+type gitlabTransport struct {
+	userAgent string
+	sudo      string
+	next      http.RoundTripper
+}
+
+func (t *gitlabTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	if t.sudo != "" {
+		req.Header.Set("Sudo", t.sudo)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newGitLabHTTPClient returns an HTTP client that sends userAgent with every request and acts as
+// the sudo user when it is set
+func newGitLabHTTPClient(userAgent, sudo string) *http.Client {
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	return &http.Client{
+		Transport: &gitlabTransport{
+			userAgent: userAgent,
+			sudo:      sudo,
+			next:      http.DefaultTransport,
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, injected at build time with
+// -ldflags "-X gitlab.com/eddiezane/kubectl-gitlab_bootstrap/pkg/cmd.Commit=... -X gitlab.com/eddiezane/kubectl-gitlab_bootstrap/pkg/cmd.BuildDate=..."
+var (
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// VersionInfo describes the plugin build for bug reports
+type VersionInfo struct {
+	Version         string `json:"version"`
+	Commit          string `json:"commit"`
+	BuildDate       string `json:"build_date"`
+	GoGitLabVersion string `json:"go_gitlab_version"`
+	ClientGoVersion string `json:"client_go_version"`
+}
+
+// versionString returns the plugin version along with its build metadata
+func versionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, BuildDate)
+}
+
+// GetVersionInfo returns the version of the plugin and of its GitLab and Kubernetes clients
+func GetVersionInfo() VersionInfo {
+	info := VersionInfo{
+		Version:         Version,
+		Commit:          Commit,
+		BuildDate:       BuildDate,
+		GoGitLabVersion: "unknown",
+		ClientGoVersion: "unknown",
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range buildInfo.Deps {
+			switch dep.Path {
+			case "github.com/xanzy/go-gitlab":
+				info.GoGitLabVersion = dep.Version
+			case "k8s.io/client-go":
+				info.ClientGoVersion = dep.Version
+			}
+		}
+	}
+	return info
+}
+
+// NewCmdVersion creates and returns the version subcommand
+func NewCmdVersion(o *GitLabBootstrapOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Prints the plugin version and build metadata",
+		Args:  cobra.NoArgs,
+		RunE: o.withJSONErrors(func(c *cobra.Command, args []string) error {
+			info := GetVersionInfo()
+			switch o.Output {
+			case "json":
+				data, err := json.MarshalIndent(info, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "unable to marshal version")
+				}
+				fmt.Fprintln(o.Out, string(data))
+			case "":
+				fmt.Fprintf(o.Out, "kubectl-gitlab_bootstrap %s\n", versionString())
+				fmt.Fprintf(o.Out, "go-gitlab %s\n", info.GoGitLabVersion)
+				fmt.Fprintf(o.Out, "client-go %s\n", info.ClientGoVersion)
+			default:
+				return classifyError(fmt.Errorf("unsupported output format %q", o.Output), StageValidate)
+			}
+			return nil
+		}),
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "Output format. One of: json")
+
+	return cmd
+}